@@ -0,0 +1,226 @@
+package cmd
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/danielmmetz/settle/internal/config"
+	"github.com/danielmmetz/settle/internal/edit"
+	"github.com/peterbourgon/ff/v3"
+	"github.com/peterbourgon/ff/v3/ffcli"
+	"gopkg.in/yaml.v3"
+)
+
+// entryKind describes a kind of list entry that may be added to or removed from the config.
+type entryKind struct {
+	name string
+	noun string
+	// arg describes the command line argument expected when adding.
+	arg string
+	// keys is the path to the list within the config.
+	keys []string
+	// shorthand is the path to the list when the stanza is instead written as a bare list.
+	// It's used unless the stanza is written as a mapping.
+	shorthand []string
+	// parse converts the command line argument into the entry's name and the node to add.
+	parse func(arg string) (string, *yaml.Node, error)
+}
+
+var entryKinds = []entryKind{
+	{
+		name: "brew",
+		noun: "brew package",
+		arg:  "<name>",
+		keys: []string{"brew", "pkgs"},
+		parse: func(arg string) (string, *yaml.Node, error) {
+			return arg, edit.Map("name", arg), nil
+		},
+	},
+	{
+		name: "cask",
+		noun: "brew cask",
+		arg:  "<name>",
+		keys: []string{"brew", "casks"},
+		parse: func(arg string) (string, *yaml.Node, error) {
+			return arg, edit.Scalar(arg), nil
+		},
+	},
+	{
+		name:      "apt",
+		noun:      "apt package",
+		arg:       "<name>",
+		keys:      []string{"apt", "pkgs"},
+		shorthand: []string{"apt"},
+		parse: func(arg string) (string, *yaml.Node, error) {
+			return arg, edit.Scalar(arg), nil
+		},
+	},
+	{
+		name:      "dnf",
+		noun:      "dnf package",
+		arg:       "<name>",
+		keys:      []string{"dnf", "pkgs"},
+		shorthand: []string{"dnf"},
+		parse: func(arg string) (string, *yaml.Node, error) {
+			return arg, edit.Scalar(arg), nil
+		},
+	},
+	{
+		name:      "apk",
+		noun:      "apk package",
+		arg:       "<name>",
+		keys:      []string{"apk", "pkgs"},
+		shorthand: []string{"apk"},
+		parse: func(arg string) (string, *yaml.Node, error) {
+			return arg, edit.Scalar(arg), nil
+		},
+	},
+	{
+		name:      "zypper",
+		noun:      "zypper package",
+		arg:       "<name>",
+		keys:      []string{"zypper", "pkgs"},
+		shorthand: []string{"zypper"},
+		parse: func(arg string) (string, *yaml.Node, error) {
+			return arg, edit.Scalar(arg), nil
+		},
+	},
+	{
+		name:      "package",
+		noun:      "package",
+		arg:       "<name>",
+		keys:      []string{"packages", "pkgs"},
+		shorthand: []string{"packages"},
+		parse: func(arg string) (string, *yaml.Node, error) {
+			return arg, edit.Scalar(arg), nil
+		},
+	},
+	{
+		name: "alias",
+		noun: "zsh alias",
+		arg:  "<name>=<value>",
+		keys: []string{"zsh", "aliases"},
+		parse: func(arg string) (string, *yaml.Node, error) {
+			name, value, ok := strings.Cut(arg, "=")
+			if !ok {
+				return name, nil, fmt.Errorf("expected alias in the form name=value, got %s", arg)
+			}
+			return name, edit.Map("name", name, "value", value), nil
+		},
+	},
+	{
+		name: "plugin",
+		noun: "neovim plugin",
+		arg:  "<repo>",
+		keys: []string{"nvim", "plugins"},
+		parse: func(arg string) (string, *yaml.Node, error) {
+			return arg, edit.Map("name", arg), nil
+		},
+	},
+}
+
+func Add(settingsPath string) *ffcli.Command {
+	return entryCommand(settingsPath, "add", "Add an entry to the config, preserving its comments and formatting.", addEntry)
+}
+
+func Remove(settingsPath string) *ffcli.Command {
+	return entryCommand(settingsPath, "remove", "Remove an entry from the config, preserving its comments and formatting.", removeEntry)
+}
+
+func entryCommand(settingsPath, verb, help string, apply func(*edit.Document, entryKind, string) error) *ffcli.Command {
+	fs := flag.NewFlagSet("settle "+verb, flag.ExitOnError)
+	configPath := fs.String("config", "", "use config file at given path")
+
+	var names []string
+	var subcommands []*ffcli.Command
+	for _, kind := range entryKinds {
+		arg := "<name>"
+		if verb == "add" {
+			arg = kind.arg
+		}
+		names = append(names, kind.name)
+		subcommands = append(subcommands, &ffcli.Command{
+			Name:       kind.name,
+			ShortUsage: fmt.Sprintf("settle %s %s %s...", verb, kind.name, arg),
+			ShortHelp:  fmt.Sprintf("%s a %s.", strings.ToUpper(verb[:1])+verb[1:], kind.noun),
+			Exec: func(_ context.Context, args []string) error {
+				if len(args) == 0 {
+					return fmt.Errorf("expected at least one %s", kind.noun)
+				}
+				c, err := config.Load(*configPath)
+				if err != nil {
+					return fmt.Errorf("error loading config: %w", err)
+				}
+				doc, err := edit.Owner(c.Path(), kind.keys[0])
+				if err != nil {
+					return err
+				}
+				for _, arg := range args {
+					if err := apply(doc, kind, arg); err != nil {
+						return err
+					}
+				}
+				return doc.Save()
+			},
+		})
+	}
+
+	return &ffcli.Command{
+		Name:        verb,
+		ShortUsage:  fmt.Sprintf("settle %s [-config path] %s <name>...", verb, strings.Join(names, "|")),
+		ShortHelp:   help,
+		FlagSet:     fs,
+		Subcommands: subcommands,
+		Options: []ff.Option{
+			ff.WithConfigFile(settingsPath),
+			ff.WithConfigFileParser(config.Parser()),
+			ff.WithAllowMissingConfigFile(true),
+		},
+		Exec: func(_ context.Context, _ []string) error {
+			return fmt.Errorf("expected one of the subcommands %s", strings.Join(names, ", "))
+		},
+	}
+}
+
+func (k entryKind) keysFor(doc *edit.Document) []string {
+	if k.shorthand != nil && doc.Kind(k.shorthand) != yaml.MappingNode {
+		return k.shorthand
+	}
+	return k.keys
+}
+
+func addEntry(doc *edit.Document, kind entryKind, arg string) error {
+	name, node, err := kind.parse(arg)
+	if err != nil {
+		return err
+	}
+	keys := kind.keysFor(doc)
+	if doc.Contains(keys, matchName(name)) {
+		fmt.Printf("%s %s is already present in %s\n", kind.noun, name, doc.Path())
+		return nil
+	}
+	if err := doc.Append(keys, node); err != nil {
+		return fmt.Errorf("error adding %s %s: %w", kind.noun, name, err)
+	}
+	fmt.Printf("added %s %s to %s\n", kind.noun, name, doc.Path())
+	return nil
+}
+
+func removeEntry(doc *edit.Document, kind entryKind, arg string) error {
+	name, _, _ := strings.Cut(arg, "=")
+	n, err := doc.Remove(kind.keysFor(doc), matchName(name))
+	if err != nil {
+		return fmt.Errorf("error removing %s %s: %w", kind.noun, name, err)
+	}
+	if n == 0 {
+		return fmt.Errorf("%s %s not found in %s", kind.noun, name, doc.Path())
+	}
+	fmt.Printf("removed %s %s from %s\n", kind.noun, name, doc.Path())
+	return nil
+}
+
+func matchName(name string) func(*yaml.Node) bool {
+	return func(n *yaml.Node) bool { return edit.Name(n) == name }
+}
@@ -0,0 +1,139 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/danielmmetz/settle/internal/config"
+	"github.com/danielmmetz/settle/internal/edit"
+	"github.com/danielmmetz/settle/internal/files"
+	"github.com/danielmmetz/settle/internal/journal"
+	"github.com/peterbourgon/ff/v3"
+	"github.com/peterbourgon/ff/v3/ffcli"
+)
+
+func Adopt(settingsPath string) *ffcli.Command {
+	fs := flag.NewFlagSet("settle adopt", flag.ExitOnError)
+	configPath := fs.String("config", "", "use config file at given path")
+	as := fs.String("as", "", "name of the file within the dotfiles directory (defaults to the file's name without a leading dot)")
+
+	return &ffcli.Command{
+		Name:       "adopt",
+		ShortUsage: "settle adopt [-config path] [-as name] <path>",
+		ShortHelp:  "Move an existing file next to the config, symlink it back into place, and add it to the files stanza.",
+		FlagSet:    fs,
+		Options: []ff.Option{
+			ff.WithConfigFile(settingsPath),
+			ff.WithConfigFileParser(config.Parser()),
+			ff.WithAllowMissingConfigFile(true),
+		},
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("expected exactly one path to adopt, got %d", len(args))
+			}
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return fmt.Errorf("unable to determine home dir: %w", err)
+			}
+			target, err := filepath.Abs(expandHome(args[0], home))
+			if err != nil {
+				return fmt.Errorf("error determing absolute path from %s: %w", args[0], err)
+			}
+
+			c, err := config.Load(*configPath)
+			if err != nil {
+				return fmt.Errorf("error loading config: %w", err)
+			}
+			if c.Files != nil {
+				for _, m := range *c.Files {
+					if m.Dst == target {
+						return fmt.Errorf("%s is already managed: it is symlinked from %s", target, m.Src)
+					}
+				}
+			}
+
+			info, err := os.Lstat(target)
+			if err != nil {
+				return fmt.Errorf("error reading file info for %s: %w", target, err)
+			}
+			if info.Mode()&os.ModeSymlink != 0 {
+				return fmt.Errorf("%s is a symlink: adopt the file it points to instead", target)
+			}
+
+			name := *as
+			if name == "" {
+				name = strings.TrimPrefix(filepath.Base(target), ".")
+			}
+			configDir := filepath.Dir(c.Path())
+			src := filepath.Join(configDir, name)
+			if _, err := os.Lstat(src); err == nil {
+				return fmt.Errorf("%s already exists: pass -as to choose a different name", src)
+			}
+
+			doc, err := edit.Owner(c.Path(), "files")
+			if err != nil {
+				return err
+			}
+			if err := doc.Append([]string{"files"}, edit.Map("src", name, "dst", collapseHome(target, home))); err != nil {
+				return fmt.Errorf("error adding files mapping: %w", err)
+			}
+
+			// each step is journaled such that a failure partway through leaves the file where it was found
+			j := journal.New()
+			if err := adopt(journal.With(ctx, j), target, src, doc); err != nil {
+				restored, restoreErr := j.Restore()
+				for _, path := range restored {
+					fmt.Println("restored", path)
+				}
+				return errors.Join(err, restoreErr)
+			}
+			return nil
+		},
+	}
+}
+
+// adopt moves target to src, symlinks it back into place, and saves doc, which maps the one to the other.
+func adopt(ctx context.Context, target, src string, doc *edit.Document) error {
+	if err := journal.MkdirAll(ctx, filepath.Dir(src), 0o755); err != nil {
+		return fmt.Errorf("error making intermediate directories for %s: %w", src, err)
+	}
+	fmt.Printf("moving %s to %s\n", target, src)
+	if err := journal.Move(ctx, target, src); err != nil {
+		return fmt.Errorf("error moving %s to %s: %w", target, src, err)
+	}
+	mapping := files.Files{{Src: src, Dst: target}}
+	if err := mapping.Ensure(ctx); err != nil {
+		return err
+	}
+	fmt.Println("adding files mapping to", doc.Path())
+	info, err := os.Stat(doc.Path())
+	if err != nil {
+		return fmt.Errorf("error reading file info for %s: %w", doc.Path(), err)
+	}
+	return journal.WriteFile(ctx, doc.Path(), doc.Bytes(), info.Mode().Perm())
+}
+
+// expandHome resolves a leading ~ in path to home.
+func expandHome(path, home string) string {
+	if path == "~" {
+		return home
+	}
+	if rest, ok := strings.CutPrefix(path, "~"+string(os.PathSeparator)); ok {
+		return filepath.Join(home, rest)
+	}
+	return path
+}
+
+// collapseHome rewrites path in terms of ~ if it is within home.
+func collapseHome(path, home string) string {
+	rel, err := filepath.Rel(home, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(os.PathSeparator)) {
+		return path
+	}
+	return filepath.Join("~", rel)
+}
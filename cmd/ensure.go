@@ -4,8 +4,14 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"os"
 
 	"github.com/danielmmetz/settle/internal/config"
+	"github.com/danielmmetz/settle/internal/lock"
+	"github.com/danielmmetz/settle/internal/plan"
+	"github.com/danielmmetz/settle/internal/privilege"
+	"github.com/danielmmetz/settle/internal/progress"
+	"github.com/danielmmetz/settle/internal/stream"
 	"github.com/peterbourgon/ff/v3"
 	"github.com/peterbourgon/ff/v3/ffcli"
 )
@@ -14,10 +20,14 @@ func Ensure(settingsPath string) *ffcli.Command {
 	fs := flag.NewFlagSet("settle ensure", flag.ExitOnError)
 	configPath := fs.String("config", "", "use config file at given path")
 	target := fs.String("target", "", "apply only specified stanza of the config")
+	planOnly := fs.Bool("plan", false, "report the changes that would be made without making them")
+	wait := fs.Bool("wait", false, "wait for another in-progress settle run to finish rather than failing")
+	plain := fs.Bool("plain", false, "print plain line output rather than a live progress view, as when stdout isn't a terminal")
+	escalate := fs.String("escalate", escalateDefault(), "command with which to run commands as root, e.g. doas (also via SETTLE_ESCALATE)")
 
 	return &ffcli.Command{
 		Name:       "ensure",
-		ShortUsage: "settle ensure [-config path] [-target files|brew|apt|pacman|nvim|zsh]",
+		ShortUsage: "settle ensure [-config path] [-target files|brew|apt|pacman|dnf|apk|zypper|packages|nvim|zsh] [-plan] [-plain] [-wait] [-escalate sudo|doas]",
 		FlagSet:    fs,
 		Options: []ff.Option{
 			ff.WithConfigFile(settingsPath),
@@ -25,14 +35,49 @@ func Ensure(settingsPath string) *ffcli.Command {
 			ff.WithAllowMissingConfigFile(true),
 		},
 		Exec: func(ctx context.Context, _ []string) error {
+			lockPath, err := lock.Path()
+			if err != nil {
+				return err
+			}
+			l, err := lock.Acquire(ctx, lockPath, *wait)
+			if err != nil {
+				return err
+			}
+			defer l.Release()
+
 			c, err := config.Load(*configPath, config.OptionFrom(*target))
 			if err != nil {
 				return fmt.Errorf("error loading config: %w", err)
 			}
 
-			if err := c.Ensure(ctx); err != nil {
+			escalator := privilege.New(*escalate)
+			ctx = privilege.With(ctx, escalator)
+			if *planOnly {
+				return c.Ensure(plan.With(ctx))
+			}
+
+			log, err := stream.CreateLog()
+			if err != nil {
 				return err
 			}
+			defer log.Close()
+			ctx = stream.WithLog(ctx, log)
+			// credentials are obtained on the first command that needs them, if any
+			defer escalator.Release()
+			err = func() error {
+				if *plain || !progress.Interactive() {
+					return c.Ensure(ctx)
+				}
+				view, err := progress.Start(c.Stanzas())
+				if err != nil {
+					return err
+				}
+				defer view.Stop()
+				return c.Ensure(progress.With(ctx, view))
+			}()
+			if err != nil {
+				return fmt.Errorf("%w\nthe full output of this run is logged to %s", err, log.Path())
+			}
 
 			if *target != "" {
 				fmt.Println("skipping writing of settings.yaml and creating settle.yaml backup: non-zero target specified:", *target)
@@ -43,3 +88,12 @@ func Ensure(settingsPath string) *ffcli.Command {
 		},
 	}
 }
+
+// escalateDefault returns the escalation command given by SETTLE_ESCALATE, if any, or sudo.
+// Only that variable is read, rather than every SETTLE_ variable that happens to match a flag.
+func escalateDefault() string {
+	if command := os.Getenv("SETTLE_ESCALATE"); command != "" {
+		return command
+	}
+	return "sudo"
+}
@@ -0,0 +1,180 @@
+package cmd
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/danielmmetz/settle/internal/brew"
+	"github.com/danielmmetz/settle/internal/config"
+	"github.com/danielmmetz/settle/internal/edit"
+	ghodss "github.com/ghodss/yaml"
+	"github.com/peterbourgon/ff/v3"
+	"github.com/peterbourgon/ff/v3/ffcli"
+	"gopkg.in/yaml.v3"
+)
+
+func Import(settingsPath string) *ffcli.Command {
+	fs := flag.NewFlagSet("settle import", flag.ExitOnError)
+	configPath := fs.String("config", "", "use config file at given path")
+
+	return &ffcli.Command{
+		Name:       "import",
+		ShortUsage: "settle import [-config path] brewfile <path>",
+		ShortHelp:  "Import entries from another tool's file into the config, preserving its comments and formatting.",
+		FlagSet:    fs,
+		Subcommands: []*ffcli.Command{
+			{
+				Name:       "brewfile",
+				ShortUsage: "settle import brewfile <path>",
+				ShortHelp:  "Import the taps, packages, casks, and other entries of a Brewfile into the brew stanza.",
+				Exec: func(_ context.Context, args []string) error {
+					if len(args) != 1 {
+						return fmt.Errorf("expected exactly one Brewfile to import, got %d", len(args))
+					}
+					return importBrewfile(*configPath, args[0])
+				},
+			},
+		},
+		Options: []ff.Option{
+			ff.WithConfigFile(settingsPath),
+			ff.WithConfigFileParser(config.Parser()),
+			ff.WithAllowMissingConfigFile(true),
+		},
+		Exec: func(_ context.Context, _ []string) error {
+			return fmt.Errorf("expected the subcommand brewfile")
+		},
+	}
+}
+
+// importBrewfile adds the entries of the Brewfile at path to the brew stanza, skipping those already present.
+func importBrewfile(configPath, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("error opening %s: %w", path, err)
+	}
+	defer f.Close()
+	b, err := brew.ParseBrewfile(f)
+	if err != nil {
+		return fmt.Errorf("error parsing %s: %w", path, err)
+	}
+
+	c, err := config.Load(configPath)
+	if err != nil {
+		return fmt.Errorf("error loading config: %w", err)
+	}
+	doc, err := edit.Owner(c.Path(), "brew")
+	if err != nil {
+		return err
+	}
+
+	var added, present int
+	appendEntry := func(list, noun, name string, match func(*yaml.Node) bool, entry any) error {
+		keys := []string{"brew", list}
+		if doc.Contains(keys, match) {
+			present++
+			return nil
+		}
+		n, err := node(entry)
+		if err != nil {
+			return err
+		}
+		if err := doc.Append(keys, n); err != nil {
+			return fmt.Errorf("error adding %s %s: %w", noun, name, err)
+		}
+		added++
+		return nil
+	}
+
+	argNames := make([]string, 0, len(b.CaskArgs))
+	for name := range b.CaskArgs {
+		argNames = append(argNames, name)
+	}
+	sort.Strings(argNames)
+	for _, name := range argNames {
+		keys := []string{"brew", "cask_args", name}
+		if doc.Kind(keys) != 0 {
+			present++
+			continue
+		}
+		n, err := node(b.CaskArgs[name])
+		if err != nil {
+			return err
+		}
+		if err := doc.Put(keys, n); err != nil {
+			return fmt.Errorf("error setting cask_args %s: %w", name, err)
+		}
+		added++
+	}
+	for _, tap := range b.Taps {
+		if err := appendEntry("taps", "tap", tap.Repo, matchKey("repo", tap.Repo), tap); err != nil {
+			return err
+		}
+	}
+	for _, pkg := range b.Pkgs {
+		if err := appendEntry("pkgs", "brew package", pkg.Name, matchName(pkg.Name), pkg); err != nil {
+			return err
+		}
+	}
+	for _, cask := range b.Casks {
+		if err := appendEntry("casks", "brew cask", cask.Name, matchName(cask.Name), cask); err != nil {
+			return err
+		}
+	}
+	for _, app := range b.Mas {
+		if err := appendEntry("mas", "mas app", app.Name, matchName(app.Name), app); err != nil {
+			return err
+		}
+	}
+	for _, image := range b.Whalebrew {
+		if err := appendEntry("whalebrew", "whalebrew image", image, matchName(image), image); err != nil {
+			return err
+		}
+	}
+	for _, extension := range b.VSCode {
+		if err := appendEntry("vscode", "vscode extension", extension, matchName(extension), extension); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("imported %d entries from %s into %s (%d already present)\n", added, path, doc.Path(), present)
+	if added == 0 {
+		return nil
+	}
+	return doc.Save()
+}
+
+// node converts v into a YAML node by way of its JSON encoding, such that it's written as the config expects it.
+// Mapping keys are sorted, save for name, which leads.
+func node(v any) (*yaml.Node, error) {
+	b, err := ghodss.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding %v: %w", v, err)
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		return nil, fmt.Errorf("error encoding %v: %w", v, err)
+	}
+	n := doc.Content[0]
+	for i := 2; n.Kind == yaml.MappingNode && i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == "name" {
+			name := append([]*yaml.Node{}, n.Content[i:i+2]...)
+			n.Content = append(name, append(n.Content[:i], n.Content[i+2:]...)...)
+			break
+		}
+	}
+	return n, nil
+}
+
+func matchKey(key, value string) func(*yaml.Node) bool {
+	return func(n *yaml.Node) bool {
+		for i := 0; n.Kind == yaml.MappingNode && i+1 < len(n.Content); i += 2 {
+			if n.Content[i].Value == key {
+				return n.Content[i+1].Value == value
+			}
+		}
+		return false
+	}
+}
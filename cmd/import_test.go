@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestImportBrewfile(t *testing.T) {
+	t.Chdir(t.TempDir())
+	dir := t.TempDir()
+	configPath, brewfilePath := filepath.Join(dir, "settle.yaml"), filepath.Join(dir, "Brewfile")
+	config := `# my machine
+brew:
+  taps:
+    - repo: homebrew/cask-fonts  # fonts
+  pkgs:
+    - name: ripgrep  # search
+  # apps
+  casks:
+    - iterm2
+
+# dotfiles
+files: []
+`
+	brewfile := `cask_args appdir: "~/Applications"
+tap "homebrew/cask-fonts"
+tap "owner/tap", "https://example.com/tap.git"
+brew "ripgrep"
+brew "postgresql@16", restart_service: :changed, link: false
+cask "iterm2"
+cask "firefox", args: { appdir: "/Applications" }
+`
+	for path, contents := range map[string]string{configPath: config, brewfilePath: brewfile} {
+		if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// existing entries are skipped, comments survive, and name leads the keys of new entries
+	want := `# my machine
+brew:
+  taps:
+    - repo: homebrew/cask-fonts  # fonts
+    - repo: owner/tap
+      url: https://example.com/tap.git
+  pkgs:
+    - name: ripgrep  # search
+    - name: postgresql@16
+      link: false
+      restart_service: changed
+  # apps
+  casks:
+    - iterm2
+    - name: firefox
+      args:
+        appdir: /Applications
+  cask_args:
+    appdir: ~/Applications
+
+# dotfiles
+files: []
+`
+	// importing again changes nothing
+	for range 2 {
+		if err := importBrewfile(configPath, brewfilePath); err != nil {
+			t.Fatal(err)
+		}
+		got, err := os.ReadFile(configPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Fatalf("got:\n%s\nwant:\n%s", got, want)
+		}
+	}
+}
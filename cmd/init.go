@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/danielmmetz/settle/internal/atomicfile"
+	"github.com/danielmmetz/settle/internal/config"
+	"github.com/peterbourgon/ff/v3/ffcli"
+)
+
+func Init() *ffcli.Command {
+	fs := flag.NewFlagSet("settle init", flag.ExitOnError)
+	configPath := fs.String("config", "settle.yaml", "write the generated config file to the given path")
+	force := fs.Bool("force", false, "overwrite the config file if it already exists")
+	dotfiles := fs.Bool("dotfiles", false, "copy dotfiles from the home directory alongside the config file and map them, skipping those that may hold credentials")
+
+	return &ffcli.Command{
+		Name:       "init",
+		ShortUsage: "settle init [-config path] [-force] [-dotfiles]",
+		ShortHelp:  "Generate a starter config by inspecting the current machine.",
+		FlagSet:    fs,
+		Exec: func(ctx context.Context, _ []string) error {
+			absPath, err := filepath.Abs(*configPath)
+			if err != nil {
+				return fmt.Errorf("error determing absolute path from %s: %w", *configPath, err)
+			}
+			if _, err := os.Stat(absPath); err == nil && !*force {
+				return fmt.Errorf("%s already exists: pass -force to overwrite it", absPath)
+			} else if err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+			if err := os.MkdirAll(filepath.Dir(absPath), 0o755); err != nil {
+				return fmt.Errorf("error making intermediate directories for %s: %w", absPath, err)
+			}
+
+			c, err := config.Scaffold(ctx, filepath.Dir(absPath), *dotfiles)
+			if err != nil {
+				return fmt.Errorf("error inspecting machine: %w", err)
+			}
+			contents := append([]byte("# Generated by `settle init`. Review before running `settle`.\n"), c.YAML()...)
+			if err := atomicfile.WriteFile(absPath, contents, 0o644); err != nil {
+				return fmt.Errorf("error writing %s: %w", absPath, err)
+			}
+			fmt.Println("wrote config to", absPath)
+			return nil
+		},
+	}
+}
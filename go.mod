@@ -6,6 +6,7 @@ require (
 	github.com/ghodss/yaml v1.0.0
 	github.com/peterbourgon/ff/v3 v3.3.0
 	golang.org/x/exp v0.0.0-20221114191408-850992195362
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
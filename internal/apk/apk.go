@@ -0,0 +1,135 @@
+package apk
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/danielmmetz/settle/internal/pkgmgr"
+	"github.com/danielmmetz/settle/internal/plan"
+)
+
+// worldPath is the file within which apk records the packages explicitly requested by the user.
+var worldPath = "/etc/apk/world"
+
+type Apk struct {
+	Pkgs []string `json:"pkgs"`
+	// Prune opts in to removing packages from the world file that aren't declared in Pkgs.
+	Prune *pkgmgr.Prune `json:"prune,omitempty"`
+}
+
+func (a *Apk) UnmarshalJSON(b []byte) error {
+	if pkgs, ok := pkgmgr.BareList[string](b); ok {
+		*a = Apk{Pkgs: pkgs}
+		return nil
+	}
+	type apk Apk
+	var intermediary apk
+	if err := json.Unmarshal(b, &intermediary); err != nil {
+		return err
+	}
+	*a = Apk(intermediary)
+	return nil
+}
+
+func (a *Apk) Ensure(ctx context.Context) error {
+	if a == nil {
+		return nil
+	}
+
+	// Packages installed only as a dependency are absent from the world file.
+	// Adding them records them as requested, such that they survive the removal of whatever depended on them.
+	world, err := readWorld()
+	if err != nil {
+		return err
+	}
+	requested := make(map[string]bool)
+	for _, name := range world {
+		requested[name] = true
+	}
+	var missing []string
+	for _, pkg := range a.Pkgs {
+		if !requested[pkg] {
+			missing = append(missing, pkg)
+		}
+	}
+	if err := a.install(ctx, missing); err != nil {
+		return err
+	}
+	if a.Prune == nil {
+		return nil
+	}
+	return a.prune(ctx, world)
+}
+
+func (a *Apk) install(ctx context.Context, missing []string) error {
+	if len(missing) == 0 {
+		fmt.Printf("all %d apk packages already present\n", len(a.Pkgs))
+		return nil
+	}
+	if plan.Enabled(ctx) {
+		fmt.Printf("would install %d missing apk packages: %s\n", len(missing), strings.Join(missing, " "))
+		return nil
+	}
+
+	fmt.Printf("installing %d missing packages with `apk add`: %s\n", len(missing), strings.Join(missing, " "))
+	if err := (pkgmgr.Apk{}).Install(ctx, missing); err != nil {
+		return err
+	}
+	fmt.Printf("installed %d apk packages, %d already present\n", len(missing), len(a.Pkgs)-len(missing))
+	return nil
+}
+
+// prune removes packages from the world file that are neither declared, allowed, nor protected.
+// apk then removes them along with any dependencies no longer needed.
+func (a *Apk) prune(ctx context.Context, world []string) error {
+	undeclared := a.undeclared(world)
+	if len(undeclared) == 0 {
+		fmt.Println("no undeclared apk packages to prune")
+		return nil
+	}
+
+	if plan.Enabled(ctx) {
+		fmt.Printf("would prune %d undeclared apk packages: %s\n", len(undeclared), strings.Join(undeclared, " "))
+		return nil
+	}
+	fmt.Printf("pruning %d undeclared packages with `apk del`: %s\n", len(undeclared), strings.Join(undeclared, " "))
+	return pkgmgr.Apk{}.Remove(ctx, undeclared)
+}
+
+// undeclared returns the sorted names of the packages within world that are neither declared, allowed, nor protected.
+func (a *Apk) undeclared(world []string) []string {
+	return a.Prune.Undeclared(pkgmgr.Apk{}, world, a.Pkgs)
+}
+
+// readWorld returns the sorted names of the packages within the world file, stripped of any version or repository constraints.
+func readWorld() ([]string, error) {
+	b, err := os.ReadFile(worldPath)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", worldPath, err)
+	}
+	var names []string
+	for _, entry := range strings.Fields(string(b)) {
+		// entries take the form name, name=1.2, name>1.2, name~1.2, or name@testing
+		if i := strings.IndexAny(entry, "=<>~@"); i != -1 {
+			entry = entry[:i]
+		}
+		if entry != "" {
+			names = append(names, entry)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Current returns the packages within the world file.
+func Current(ctx context.Context) (*Apk, error) {
+	names, err := readWorld()
+	if err != nil {
+		return nil, err
+	}
+	return &Apk{Pkgs: names}, nil
+}
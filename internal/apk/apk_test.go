@@ -0,0 +1,59 @@
+package apk
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/danielmmetz/settle/internal/pkgmgr"
+)
+
+func TestReadWorld(t *testing.T) {
+	defer func(w string) { worldPath = w }(worldPath)
+	worldPath = filepath.Join(t.TempDir(), "world")
+	world := "alpine-base\nbusybox\ngit=2.45.2-r0\nnodejs>20\npython3~3.12\nneovim@edge\ncurl\n"
+	if err := os.WriteFile(worldPath, []byte(world), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := readWorld()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"alpine-base", "busybox", "curl", "git", "neovim", "nodejs", "python3"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestUndeclared(t *testing.T) {
+	world := []string{"alpine-base", "busybox", "curl", "git", "htop", "musl", "neovim"}
+	tests := []struct {
+		name string
+		apk  Apk
+		want []string
+	}{
+		{
+			name: "declared",
+			apk:  Apk{Pkgs: []string{"git", "neovim"}, Prune: &pkgmgr.Prune{}},
+			want: []string{"curl", "htop"},
+		},
+		{
+			name: "allowed",
+			apk:  Apk{Pkgs: []string{"git"}, Prune: &pkgmgr.Prune{Allow: []string{"htop"}}},
+			want: []string{"curl", "neovim"},
+		},
+		{
+			name: "everything declared or protected",
+			apk:  Apk{Pkgs: []string{"curl", "git", "htop", "neovim"}, Prune: &pkgmgr.Prune{}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.apk.undeclared(world); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
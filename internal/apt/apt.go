@@ -2,29 +2,205 @@ package apt
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
-	"os/exec"
+	"strings"
+
+	"github.com/danielmmetz/settle/internal/pkgmgr"
+	"github.com/danielmmetz/settle/internal/plan"
+	"github.com/danielmmetz/settle/internal/privilege"
+	"github.com/danielmmetz/settle/internal/stream"
 )
 
-type Apt []string
+type Apt struct {
+	Sources []Source `json:"sources,omitempty"`
+	Pkgs    []Pkg    `json:"pkgs"`
+	// Prune opts in to cleaning up manually installed packages that aren't declared in Pkgs.
+	Prune *Prune `json:"prune,omitempty"`
+}
+
+type Prune struct {
+	pkgmgr.Prune
+	// Action is either "mark-auto", to mark undeclared packages as automatically installed
+	// such that a later autoremove cleans them up if nothing depends on them,
+	// or "remove", to do so and run autoremove immediately.
+	Action string `json:"action"`
+}
+
+func (a *Apt) UnmarshalJSON(b []byte) error {
+	if pkgs, ok := pkgmgr.BareList[Pkg](b); ok {
+		*a = Apt{Pkgs: pkgs}
+		return nil
+	}
+	type apt Apt
+	var intermediary apt
+	if err := json.Unmarshal(b, &intermediary); err != nil {
+		return err
+	}
+	if p := intermediary.Prune; p != nil {
+		switch p.Action {
+		case "":
+			p.Action = "mark-auto"
+		case "mark-auto", "remove":
+		default:
+			return fmt.Errorf(`invalid prune action %q: expected "mark-auto" or "remove"`, p.Action)
+		}
+	}
+	*a = Apt(intermediary)
+	return nil
+}
 
 func (a *Apt) Ensure(ctx context.Context) error {
 	if a == nil {
 		return nil
 	}
 
-	cmd := []string{"apt", "install", "-y"}
-	cmd = append(cmd, *a...)
-	fmt.Println("installing packages with `sudo apt install`")
-	installCmd := exec.CommandContext(ctx, "sudo", cmd...)
-	if output, err := installCmd.CombinedOutput(); err != nil {
-		return fmt.Errorf("error running `sudo apt install`: %w\n%s", err, string(output))
+	changed, err := a.ensureSources(ctx)
+	if err != nil {
+		return fmt.Errorf("error ensuring apt sources: %w", err)
+	}
+	if changed && !plan.Enabled(ctx) {
+		fmt.Println("updating package lists with `apt update`")
+		if err := (pkgmgr.Apt{}).Refresh(ctx); err != nil {
+			return err
+		}
+	}
+
+	installed, err := pkgmgr.Apt{}.Packages(ctx)
+	if err != nil {
+		return err
+	}
+	var pending []Pkg
+	for _, pkg := range a.Pkgs {
+		info, ok := installed[pkg.Name]
+		switch {
+		case !ok:
+			pending = append(pending, pkg)
+		case !pkg.matches(info.Version):
+			fmt.Printf("apt package %s has drifted: installed version %s, want %s\n", pkg.Name, info.Version, pkg.Version)
+			pending = append(pending, pkg)
+		}
+	}
+	if err := a.install(ctx, pending); err != nil {
+		return err
+	}
+	if err := a.ensureHolds(ctx); err != nil {
+		return err
+	}
+	if a.Prune == nil {
+		return nil
+	}
+	return a.prune(ctx, installed)
+}
+
+// install installs pkgs, which are either missing or at a version other than the one specified.
+func (a *Apt) install(ctx context.Context, pkgs []Pkg) error {
+	if len(pkgs) == 0 {
+		fmt.Printf("all %d apt packages already present\n", len(a.Pkgs))
+		return nil
+	}
+	var args []string
+	for _, pkg := range pkgs {
+		args = append(args, pkg.String())
+	}
+	var selections []string
+	for _, pkg := range pkgs {
+		lines, err := pkg.selections()
+		if err != nil {
+			return err
+		}
+		selections = append(selections, lines...)
+	}
+	if plan.Enabled(ctx) {
+		for _, selection := range selections {
+			fmt.Println("would preseed debconf answer:", selection)
+		}
+		fmt.Printf("would install %d apt packages: %s\n", len(pkgs), strings.Join(args, " "))
+		return nil
 	}
 
-	fmt.Println("cleaning up orphan packages with `sudo apt autoremove`")
-	cleanupCmd := exec.CommandContext(ctx, "sudo", "apt", "autoremove", "-y")
-	if output, err := cleanupCmd.CombinedOutput(); err != nil {
-		return fmt.Errorf("error running `sudo apt autoremove`: %w\n%s", err, string(output))
+	if len(selections) > 0 {
+		fmt.Println("preseeding answers with `debconf-set-selections`")
+		preseedCmd := privilege.Command(ctx, "debconf-set-selections")
+		preseedCmd.Stdin = strings.NewReader(strings.Join(selections, "\n") + "\n")
+		if output, err := stream.Run(ctx, preseedCmd); err != nil {
+			return fmt.Errorf("error running `debconf-set-selections`: %w\n%s", err, string(output))
+		}
+	}
+
+	// only packages declared with hold may be changed despite being held
+	var manager pkgmgr.Apt
+	for _, pkg := range pkgs {
+		manager.AllowHeld = manager.AllowHeld || pkg.Hold
+	}
+	fmt.Printf("installing %d packages with `apt install`: %s\n", len(pkgs), strings.Join(args, " "))
+	if err := manager.Install(ctx, args); err != nil {
+		return err
+	}
+
+	if a.Prune != nil && a.Prune.Action == "remove" {
+		if err := autoremove(ctx); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("installed %d apt packages, %d already present\n", len(pkgs), len(a.Pkgs)-len(pkgs))
+	return nil
+}
+
+// prune marks manually installed packages that are neither declared, allowed, protected, nor part of the base system as automatically installed.
+func (a *Apt) prune(ctx context.Context, installed map[string]pkgmgr.AptPackage) error {
+	manual, err := pkgmgr.Apt{}.Manual(ctx)
+	if err != nil {
+		return err
+	}
+	var candidates, declared []string
+	for _, name := range manual {
+		if !installed[name].Base() {
+			candidates = append(candidates, name)
+		}
+	}
+	for _, pkg := range a.Pkgs {
+		declared = append(declared, pkg.Name)
+	}
+	undeclared := a.Prune.Undeclared(pkgmgr.Apt{}, candidates, declared)
+	if len(undeclared) == 0 {
+		fmt.Println("no undeclared apt packages to prune")
+		return nil
+	}
+
+	if plan.Enabled(ctx) {
+		fmt.Printf("would prune %d undeclared apt packages (%s): %s\n", len(undeclared), a.Prune.Action, strings.Join(undeclared, " "))
+		return nil
+	}
+	fmt.Printf("pruning %d undeclared apt packages with `apt-mark auto`: %s\n", len(undeclared), strings.Join(undeclared, " "))
+	markCmd := privilege.Command(ctx, "apt-mark", append([]string{"auto"}, undeclared...)...)
+	if output, err := stream.Run(ctx, markCmd); err != nil {
+		return fmt.Errorf("error running `apt-mark auto`: %w\n%s", err, string(output))
+	}
+	if a.Prune.Action != "remove" {
+		return nil
+	}
+	return autoremove(ctx)
+}
+
+func autoremove(ctx context.Context) error {
+	fmt.Println("cleaning up orphan packages with `apt autoremove`")
+	cleanupCmd := privilege.Command(ctx, "env", "DEBIAN_FRONTEND=noninteractive", "apt", "autoremove", "-y")
+	if output, err := stream.Run(ctx, cleanupCmd); err != nil {
+		return fmt.Errorf("error running `apt autoremove`: %w\n%s", err, string(output))
 	}
 	return nil
 }
+
+// Current returns the packages marked as manually installed, as reported by `apt-mark showmanual`.
+func Current(ctx context.Context) (*Apt, error) {
+	names, err := pkgmgr.Apt{}.Manual(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var a Apt
+	for _, name := range names {
+		a.Pkgs = append(a.Pkgs, Pkg{Name: name})
+	}
+	return &a, nil
+}
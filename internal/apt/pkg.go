@@ -0,0 +1,202 @@
+package apt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/danielmmetz/settle/internal/plan"
+	"github.com/danielmmetz/settle/internal/privilege"
+	"github.com/danielmmetz/settle/internal/stream"
+	"github.com/danielmmetz/settle/internal/sysfile"
+)
+
+// Pkg is an apt package, optionally pinned to a version.
+// It may be specified as either a bare name or a mapping.
+type Pkg struct {
+	Name string `json:"name"`
+	// Version is the version to install, which may be a glob pattern, e.g. 14.9-*.
+	Version string `json:"version,omitempty"`
+	// Hold marks the package as held back from upgrades, per `apt-mark hold`.
+	// Should hold later be dropped, settle releases the hold, provided it was settle that held the package.
+	Hold bool `json:"hold,omitempty"`
+	// Debconf preseeds answers to the package's configuration questions, keyed by question,
+	// e.g. wireshark-common/install-setuid: true.
+	// Values are booleans, strings, or mappings of the form {type: select, value: ...} for other question types.
+	Debconf map[string]any `json:"debconf,omitempty"`
+}
+
+func (p *Pkg) UnmarshalJSON(b []byte) error {
+	var name string
+	if err := json.Unmarshal(b, &name); err == nil {
+		*p = Pkg{Name: name}
+		return nil
+	}
+	type pkg Pkg
+	var intermediary pkg
+	if err := json.Unmarshal(b, &intermediary); err != nil {
+		return err
+	}
+	if intermediary.Name == "" {
+		return fmt.Errorf("package must specify a name")
+	}
+	*p = Pkg(intermediary)
+	return nil
+}
+
+func (p Pkg) MarshalJSON() ([]byte, error) {
+	if p.Version == "" && !p.Hold && len(p.Debconf) == 0 {
+		return json.Marshal(p.Name)
+	}
+	type pkg Pkg
+	return json.Marshal(pkg(p))
+}
+
+// String returns the package as an argument to `apt install`.
+func (p Pkg) String() string {
+	if p.Version == "" {
+		return p.Name
+	}
+	return p.Name + "=" + p.Version
+}
+
+// selections returns p's debconf answers in the format expected by `debconf-set-selections`.
+func (p Pkg) selections() ([]string, error) {
+	questions := make([]string, 0, len(p.Debconf))
+	for question := range p.Debconf {
+		questions = append(questions, question)
+	}
+	sort.Strings(questions)
+
+	var lines []string
+	for _, question := range questions {
+		var kind, value string
+		switch v := p.Debconf[question].(type) {
+		case bool:
+			kind, value = "boolean", strconv.FormatBool(v)
+		case string:
+			kind, value = "string", v
+		case float64:
+			kind, value = "string", strconv.FormatFloat(v, 'f', -1, 64)
+		case map[string]any:
+			kind, _ = v["type"].(string)
+			value = fmt.Sprint(v["value"])
+			if kind == "" || v["value"] == nil {
+				return nil, fmt.Errorf("debconf question %s of package %s: expected both type and value", question, p.Name)
+			}
+		default:
+			return nil, fmt.Errorf("debconf question %s of package %s: unsupported value %v", question, p.Name, v)
+		}
+		lines = append(lines, fmt.Sprintf("%s %s %s %s", p.Name, question, kind, value))
+	}
+	return lines, nil
+}
+
+// matches reports whether the installed version satisfies p.
+func (p Pkg) matches(version string) bool {
+	if p.Version == "" {
+		return true
+	}
+	ok, err := path.Match(p.Version, version)
+	return err == nil && ok
+}
+
+// holdsPath records the packages settle has held, such that it only ever releases holds of its own making.
+const holdsPath = "/var/lib/settle/apt-holds"
+
+// ensureHolds holds packages declared with hold and releases those settle held that are no longer declared with it.
+// Packages held by other means are left held.
+func (a *Apt) ensureHolds(ctx context.Context) error {
+	output, err := exec.CommandContext(ctx, "apt-mark", "showhold").Output()
+	if err != nil {
+		return fmt.Errorf("error running `apt-mark showhold`: %w", err)
+	}
+	held := make(map[string]bool)
+	for _, name := range strings.Fields(string(output)) {
+		held[name] = true
+	}
+	recorded, err := readHolds()
+	if err != nil {
+		return err
+	}
+
+	declared := make(map[string]bool)
+	var hold, unhold []string
+	for _, pkg := range a.Pkgs {
+		if pkg.Hold {
+			declared[pkg.Name] = true
+			if !held[pkg.Name] {
+				hold = append(hold, pkg.Name)
+			}
+		}
+	}
+	for name := range recorded {
+		if !declared[name] && held[name] {
+			unhold = append(unhold, name)
+		}
+	}
+	sort.Strings(unhold)
+	for _, change := range []struct {
+		verb string
+		pkgs []string
+	}{{"hold", hold}, {"unhold", unhold}} {
+		if len(change.pkgs) == 0 {
+			continue
+		}
+		if plan.Enabled(ctx) {
+			fmt.Printf("would %s apt packages: %s\n", change.verb, strings.Join(change.pkgs, " "))
+			continue
+		}
+		fmt.Printf("running `apt-mark %s`: %s\n", change.verb, strings.Join(change.pkgs, " "))
+		cmd := privilege.Command(ctx, "apt-mark", append([]string{change.verb}, change.pkgs...)...)
+		if output, err := stream.Run(ctx, cmd); err != nil {
+			return fmt.Errorf("error running `apt-mark %s`: %w\n%s", change.verb, err, string(output))
+		}
+	}
+	if plan.Enabled(ctx) {
+		return nil
+	}
+
+	// settle's holds are those it held before and still holds, along with those it just held
+	var names []string
+	for name := range recorded {
+		if declared[name] && held[name] {
+			names = append(names, name)
+		}
+	}
+	names = append(names, hold...)
+	if len(names) == 0 && recorded == nil {
+		return nil
+	}
+	sort.Strings(names)
+	var contents []byte
+	for _, name := range names {
+		contents = append(contents, name+"\n"...)
+	}
+	if _, err := sysfile.WriteFile(ctx, holdsPath, contents); err != nil {
+		return fmt.Errorf("error recording apt holds: %w", err)
+	}
+	return nil
+}
+
+// readHolds returns the packages recorded as held by settle.
+func readHolds() (map[string]bool, error) {
+	b, err := os.ReadFile(holdsPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", holdsPath, err)
+	}
+	recorded := make(map[string]bool)
+	for _, name := range strings.Fields(string(b)) {
+		recorded[name] = true
+	}
+	return recorded, nil
+}
@@ -0,0 +1,381 @@
+package apt
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/danielmmetz/settle/internal/pkgmgr"
+	"github.com/danielmmetz/settle/internal/sysfile"
+)
+
+// managedHeader begins each file settle writes to sourcesDir, by which it recognizes those it owns.
+const managedHeader = "# Managed by settle. Changes will be overwritten.\n"
+
+var (
+	sourcesDir  = "/etc/apt/sources.list.d"
+	keyringsDir = "/etc/apt/keyrings"
+	// launchpadAPI is where the signing keys of PPAs are looked up.
+	launchpadAPI = "https://api.launchpad.net/1.0"
+	// keyserver is where the signing keys of PPAs are fetched from.
+	keyserver = "https://keyserver.ubuntu.com"
+)
+
+// Source is a third-party apt repository, written as a deb822-style .sources file.
+// It may be specified as a Launchpad PPA of the form ppa:owner/name, in place of a mapping.
+type Source struct {
+	// Name identifies the source, and is used to name its .sources and keyring files.
+	// It defaults to ppa-<owner>-<name> for PPAs.
+	Name string `json:"name,omitempty"`
+	// PPA is a Launchpad PPA, e.g. neovim-ppa/unstable, from which the URIs, suites, components, and key are derived.
+	PPA   string   `json:"ppa,omitempty"`
+	Types []string `json:"types,omitempty"`
+	URIs  []string `json:"uris,omitempty"`
+	// Suites may contain {codename}, which is replaced with the release's codename, e.g. jammy.
+	Suites        []string `json:"suites,omitempty"`
+	Components    []string `json:"components,omitempty"`
+	Architectures []string `json:"architectures,omitempty"`
+	Key           *Key     `json:"key,omitempty"`
+}
+
+// Key is the signing key for a Source, installed into /etc/apt/keyrings.
+type Key struct {
+	// Exactly one of URL or Path is set.
+	URL  string `json:"url,omitempty"`
+	Path string `json:"path,omitempty"`
+	// Fingerprint is the expected fingerprint of the key. It's required when fetching a key by URL.
+	Fingerprint string `json:"fingerprint,omitempty"`
+}
+
+func (s *Source) UnmarshalJSON(b []byte) error {
+	type source Source
+	var intermediary source
+	var ppa string
+	if err := json.Unmarshal(b, &ppa); err == nil {
+		rest, ok := strings.CutPrefix(ppa, "ppa:")
+		if !ok {
+			return fmt.Errorf("invalid source %q: expected a mapping or ppa:owner/name", ppa)
+		}
+		intermediary.PPA = rest
+	} else if err := json.Unmarshal(b, &intermediary); err != nil {
+		return err
+	}
+	if p := intermediary.PPA; p != "" {
+		owner, name, ok := strings.Cut(p, "/")
+		if !ok || owner == "" || name == "" || strings.Contains(name, "/") {
+			return fmt.Errorf("invalid PPA %q: expected owner/name", p)
+		}
+		if intermediary.Name == "" {
+			intermediary.Name = "ppa-" + owner + "-" + name
+		}
+		if len(intermediary.URIs) == 0 {
+			intermediary.URIs = []string{"https://ppa.launchpadcontent.net/" + p + "/ubuntu"}
+		}
+		if len(intermediary.Suites) == 0 {
+			intermediary.Suites = []string{"{codename}"}
+		}
+		if len(intermediary.Components) == 0 {
+			intermediary.Components = []string{"main"}
+		}
+	}
+	if intermediary.Name == "" {
+		return fmt.Errorf("sources must specify a name")
+	}
+	if len(intermediary.URIs) == 0 || len(intermediary.Suites) == 0 {
+		return fmt.Errorf("source %s: uris and suites are required", intermediary.Name)
+	}
+	*s = Source(intermediary)
+	return nil
+}
+
+// ensureSources writes the keyring and .sources file for each source, and removes those settle wrote for sources no longer declared,
+// reporting whether any changed.
+func (a *Apt) ensureSources(ctx context.Context) (bool, error) {
+	changed, err := a.removeStaleSources(ctx)
+	if err != nil {
+		return false, err
+	}
+	if len(a.Sources) == 0 {
+		return changed, nil
+	}
+	codename, err := releaseCodename()
+	if err != nil {
+		return false, err
+	}
+
+	for _, s := range a.Sources {
+		if codename == "" && strings.Contains(strings.Join(s.Suites, " "), "{codename}") {
+			return false, fmt.Errorf("source %s: unable to determine release codename for suites", s.Name)
+		}
+		// keys fetched over the network are left be once installed, such that a run with nothing to do needn't be online.
+		// A PPA's key was verified against the fingerprint Launchpad lists when it was installed.
+		var keyring string
+		switch {
+		case s.PPA != "" && s.Key == nil:
+			keyring = installedKeyring(ctx, s.Name, "")
+		case s.Key != nil && s.Key.URL != "":
+			keyring = installedKeyring(ctx, s.Name, s.Key.Fingerprint)
+		}
+		if keyring == "" && s.PPA != "" && s.Key == nil {
+			key, err := launchpadKey(ctx, s.PPA)
+			if err != nil {
+				return false, fmt.Errorf("error looking up signing key for PPA %s: %w", s.PPA, err)
+			}
+			s.Key = key
+		}
+		if keyring == "" && s.Key != nil {
+			key, err := s.Key.fetch(ctx)
+			if err != nil {
+				return false, fmt.Errorf("error fetching key for source %s: %w", s.Name, err)
+			}
+			ext := ".gpg"
+			if bytes.HasPrefix(bytes.TrimSpace(key), []byte("-----BEGIN PGP PUBLIC KEY BLOCK-----")) {
+				ext = ".asc"
+			}
+			keyring = filepath.Join(keyringsDir, s.Name+ext)
+			wrote, err := sysfile.WriteFile(ctx, keyring, key)
+			if err != nil {
+				return false, err
+			}
+			changed = changed || wrote
+		}
+		wrote, err := sysfile.WriteFile(ctx, filepath.Join(sourcesDir, s.Name+".sources"), []byte(s.deb822(codename, keyring)))
+		if err != nil {
+			return false, err
+		}
+		changed = changed || wrote
+	}
+	return changed, nil
+}
+
+func (s Source) deb822(codename, keyring string) string {
+	types := s.Types
+	if len(types) == 0 {
+		types = []string{"deb"}
+	}
+	suites := make([]string, len(s.Suites))
+	for i, suite := range s.Suites {
+		suites[i] = strings.ReplaceAll(suite, "{codename}", codename)
+	}
+
+	var sb strings.Builder
+	sb.WriteString(managedHeader)
+	field := func(name string, values []string) {
+		if len(values) > 0 {
+			sb.WriteString(fmt.Sprintf("%s: %s\n", name, strings.Join(values, " ")))
+		}
+	}
+	field("Types", types)
+	field("URIs", s.URIs)
+	field("Suites", suites)
+	field("Components", s.Components)
+	field("Architectures", s.Architectures)
+	if keyring != "" {
+		field("Signed-By", []string{keyring})
+	}
+	return sb.String()
+}
+
+// removeStaleSources removes the .sources files settle wrote for sources that are no longer declared, along with their keyrings,
+// reporting whether any were removed.
+func (a *Apt) removeStaleSources(ctx context.Context) (bool, error) {
+	declared := make(map[string]bool)
+	for _, s := range a.Sources {
+		declared[s.Name+".sources"] = true
+	}
+	entries, err := os.ReadDir(sourcesDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("error reading %s: %w", sourcesDir, err)
+	}
+
+	changed := false
+	for _, e := range entries {
+		if declared[e.Name()] || !strings.HasSuffix(e.Name(), ".sources") {
+			continue
+		}
+		path := filepath.Join(sourcesDir, e.Name())
+		contents, err := os.ReadFile(path)
+		if err != nil || !bytes.HasPrefix(contents, []byte(managedHeader)) {
+			continue
+		}
+		name := strings.TrimSuffix(e.Name(), ".sources")
+		for _, p := range []string{path, filepath.Join(keyringsDir, name+".gpg"), filepath.Join(keyringsDir, name+".asc")} {
+			removed, err := sysfile.Remove(ctx, p)
+			if err != nil {
+				return false, err
+			}
+			changed = changed || removed
+		}
+	}
+	return changed, nil
+}
+
+// launchpadKey looks up the fingerprint of the signing key of ppa, of the form owner/name,
+// returning a Key that fetches it from the Ubuntu keyserver.
+func launchpadKey(ctx context.Context, ppa string) (*Key, error) {
+	owner, name, _ := strings.Cut(ppa, "/")
+	url := fmt.Sprintf("%s/~%s/+archive/ubuntu/%s", launchpadAPI, owner, name)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error building request for %s: %w", url, err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error fetching %s: unexpected status %s", url, resp.Status)
+	}
+	var archive struct {
+		Fingerprint string `json:"signing_key_fingerprint"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&archive); err != nil {
+		return nil, fmt.Errorf("error decoding %s: %w", url, err)
+	}
+	if archive.Fingerprint == "" {
+		return nil, fmt.Errorf("%s lists no signing key", url)
+	}
+	return &Key{
+		URL:         fmt.Sprintf("%s/pks/lookup?op=get&options=mr&search=0x%s", keyserver, archive.Fingerprint),
+		Fingerprint: archive.Fingerprint,
+	}, nil
+}
+
+// fetch returns the contents of the key, having verified its fingerprint if one is specified.
+func (k Key) fetch(ctx context.Context) ([]byte, error) {
+	var key []byte
+	switch {
+	case k.URL != "" && k.Path != "":
+		return nil, fmt.Errorf("only one of url or path may be specified")
+	case k.Path != "":
+		var err error
+		if key, err = os.ReadFile(k.Path); err != nil {
+			return nil, fmt.Errorf("error reading %s: %w", k.Path, err)
+		}
+	case k.URL != "":
+		if k.Fingerprint == "" {
+			return nil, fmt.Errorf("a fingerprint is required for keys fetched from %s", k.URL)
+		}
+		req, err := http.NewRequestWithContext(ctx, "GET", k.URL, nil)
+		if err != nil {
+			return nil, fmt.Errorf("error building request for %s: %w", k.URL, err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("error fetching %s: %w", k.URL, err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("error fetching %s: unexpected status %s", k.URL, resp.Status)
+		}
+		if key, err = io.ReadAll(resp.Body); err != nil {
+			return nil, fmt.Errorf("error reading %s: %w", k.URL, err)
+		}
+	default:
+		return nil, fmt.Errorf("one of url or path must be specified")
+	}
+
+	if k.Fingerprint == "" {
+		return key, nil
+	}
+	fprs, err := primaryFingerprints(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyFingerprint(fprs, k.Fingerprint); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// verifyFingerprint checks that fprs, the fingerprints of the primary keys within a keyring, are exactly the one wanted.
+// The whole keyring is trusted to sign the source, so any other key bundled alongside the wanted one is refused.
+func verifyFingerprint(fprs []string, want string) error {
+	want = normalizeFingerprint(want)
+	switch {
+	case len(fprs) == 0:
+		return fmt.Errorf("no keys found: expected %s", want)
+	case len(fprs) > 1:
+		return fmt.Errorf("expected only the key %s, got %d keys: %s", want, len(fprs), strings.Join(fprs, ", "))
+	case fprs[0] != want:
+		return fmt.Errorf("fingerprint mismatch: expected %s, got %s", want, fprs[0])
+	}
+	return nil
+}
+
+// installedKeyring returns the path of the keyring already installed for the named source, if it holds only the key with the given fingerprint,
+// or, if fingerprint is empty, any single key. Otherwise it returns the empty string.
+func installedKeyring(ctx context.Context, name, fingerprint string) string {
+	for _, ext := range []string{".asc", ".gpg"} {
+		path := filepath.Join(keyringsDir, name+ext)
+		key, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		fprs, err := primaryFingerprints(ctx, key)
+		if err != nil {
+			continue
+		}
+		if fingerprint == "" && len(fprs) == 1 || fingerprint != "" && verifyFingerprint(fprs, fingerprint) == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// primaryFingerprints returns the fingerprints of the primary keys within key, as reported by gpg.
+func primaryFingerprints(ctx context.Context, key []byte) ([]string, error) {
+	cmd := exec.CommandContext(ctx, "gpg", "--show-keys", "--with-colons", "--with-fingerprint")
+	cmd.Stdin = bytes.NewReader(key)
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("error running `gpg --show-keys`: %w", err)
+	}
+	return parsePrimaryFingerprints(string(output)), nil
+}
+
+// parsePrimaryFingerprints parses the fingerprints of primary keys from gpg's --with-colons output,
+// in which each pub record is followed by the fpr record of its fingerprint, as is each sub record of a subkey.
+func parsePrimaryFingerprints(colons string) []string {
+	var fprs []string
+	primary := false
+	for _, line := range strings.Split(colons, "\n") {
+		fields := strings.Split(line, ":")
+		switch fields[0] {
+		case "pub":
+			primary = true
+		case "sub":
+			primary = false
+		case "fpr":
+			if primary && len(fields) > 9 {
+				fprs = append(fprs, normalizeFingerprint(fields[9]))
+			}
+			primary = false
+		}
+	}
+	return fprs
+}
+
+func normalizeFingerprint(s string) string {
+	return strings.ToUpper(strings.ReplaceAll(s, " ", ""))
+}
+
+// releaseCodename returns the codename of the running release, e.g. jammy, per /etc/os-release.
+func releaseCodename() (string, error) {
+	release, err := pkgmgr.OSRelease()
+	if err != nil {
+		return "", err
+	}
+	return release["VERSION_CODENAME"], nil
+}
@@ -0,0 +1,275 @@
+package apt
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestSourceUnmarshal(t *testing.T) {
+	tests := []struct {
+		name    string
+		json    string
+		want    Source
+		wantErr string
+	}{
+		{
+			name: "ppa",
+			json: `"ppa:neovim-ppa/unstable"`,
+			want: Source{
+				Name:       "ppa-neovim-ppa-unstable",
+				PPA:        "neovim-ppa/unstable",
+				URIs:       []string{"https://ppa.launchpadcontent.net/neovim-ppa/unstable/ubuntu"},
+				Suites:     []string{"{codename}"},
+				Components: []string{"main"},
+			},
+		},
+		{
+			name: "ppa mapping with overrides",
+			json: `{"ppa": "deadsnakes/ppa", "name": "deadsnakes", "suites": ["jammy"]}`,
+			want: Source{
+				Name:       "deadsnakes",
+				PPA:        "deadsnakes/ppa",
+				URIs:       []string{"https://ppa.launchpadcontent.net/deadsnakes/ppa/ubuntu"},
+				Suites:     []string{"jammy"},
+				Components: []string{"main"},
+			},
+		},
+		{
+			name: "mapping",
+			json: `{"name": "docker", "uris": ["https://download.docker.com/linux/ubuntu"], "suites": ["{codename}"], "components": ["stable"]}`,
+			want: Source{
+				Name:       "docker",
+				URIs:       []string{"https://download.docker.com/linux/ubuntu"},
+				Suites:     []string{"{codename}"},
+				Components: []string{"stable"},
+			},
+		},
+		{
+			name:    "bare name",
+			json:    `"docker"`,
+			wantErr: "expected a mapping or ppa:owner/name",
+		},
+		{
+			name:    "malformed ppa",
+			json:    `"ppa:neovim-ppa"`,
+			wantErr: "expected owner/name",
+		},
+		{
+			name:    "missing name",
+			json:    `{"uris": ["https://example.com"], "suites": ["stable"]}`,
+			wantErr: "must specify a name",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got Source
+			err := json.Unmarshal([]byte(tt.json), &got)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLaunchpadKey(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/~neovim-ppa/+archive/ubuntu/unstable":
+			_, _ = w.Write([]byte(`{"signing_key_fingerprint": "9DBB0BE9366964F134855E2255F96FCF8231B6DD"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	defer func(api, ks string) { launchpadAPI, keyserver = api, ks }(launchpadAPI, keyserver)
+	launchpadAPI, keyserver = srv.URL, "https://keyserver.example"
+
+	key, err := launchpadKey(context.Background(), "neovim-ppa/unstable")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := Key{
+		URL:         "https://keyserver.example/pks/lookup?op=get&options=mr&search=0x9DBB0BE9366964F134855E2255F96FCF8231B6DD",
+		Fingerprint: "9DBB0BE9366964F134855E2255F96FCF8231B6DD",
+	}
+	if *key != want {
+		t.Fatalf("got %+v, want %+v", *key, want)
+	}
+
+	if _, err := launchpadKey(context.Background(), "nobody/missing"); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Fatalf("expected a 404 error, got %v", err)
+	}
+}
+
+func TestRemoveStaleSources(t *testing.T) {
+	defer func(s, k string) { sourcesDir, keyringsDir = s, k }(sourcesDir, keyringsDir)
+	sourcesDir, keyringsDir = t.TempDir(), t.TempDir()
+	for path, contents := range map[string]string{
+		filepath.Join(sourcesDir, "docker.sources"): managedHeader + "Types: deb\n",
+		filepath.Join(sourcesDir, "old.sources"):    managedHeader + "Types: deb\n",
+		filepath.Join(sourcesDir, "ubuntu.sources"): "Types: deb\n",
+		filepath.Join(sourcesDir, "vendor.list"):    managedHeader,
+		filepath.Join(keyringsDir, "docker.asc"):    "key",
+		filepath.Join(keyringsDir, "old.gpg"):       "key",
+		filepath.Join(keyringsDir, "unrelated.gpg"): "key",
+	} {
+		if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	a := &Apt{Sources: []Source{{Name: "docker"}}}
+	changed, err := a.removeStaleSources(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !changed {
+		t.Fatal("expected a change")
+	}
+	var got []string
+	for _, dir := range []string{sourcesDir, keyringsDir} {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, e := range entries {
+			got = append(got, e.Name())
+		}
+	}
+	sort.Strings(got)
+	want := []string{"docker.asc", "docker.sources", "ubuntu.sources", "unrelated.gpg", "vendor.list"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+
+	if changed, err := a.removeStaleSources(context.Background()); err != nil || changed {
+		t.Fatalf("expected no further changes, got %t, %v", changed, err)
+	}
+}
+
+func TestParsePrimaryFingerprints(t *testing.T) {
+	colons := `pub:u:255:22:F56BCE1051ECD666:1792359463:::u:::scESC:::::ed25519:::0:
+fpr:::::::::A59B78C7D07F8316B07843A5F56BCE1051ECD666:
+uid:u::::1792359463::88A1B0720BACCF81B106BA51A766B098575AEF46::a@example.com::::::::::0:
+sub:u:255:18:52BEF92184ACC8AB:1792359463::::::e:::::cv25519::
+fpr:::::::::2D412489952D69E7FB387A1952BEF92184ACC8AB:
+pub:-:255:22:0D1C8A5F3B2E4A77:1792359463:::-:::scSC:::::ed25519:::0:
+fpr:::::::::9F8E7D6C5B4A39281706F5E4D3C2B1A00D1C8A5F:
+`
+	got := parsePrimaryFingerprints(colons)
+	want := []string{"A59B78C7D07F8316B07843A5F56BCE1051ECD666", "9F8E7D6C5B4A39281706F5E4D3C2B1A00D1C8A5F"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+// genKey generates a signing key with an encryption subkey, returning it armored along with the fingerprints of the key and its subkey.
+func genKey(t *testing.T, email string) ([]byte, string, string) {
+	t.Helper()
+	gpg := func(args ...string) []byte {
+		t.Helper()
+		output, err := exec.Command("gpg", append([]string{"--batch", "--passphrase", ""}, args...)...).Output()
+		if err != nil {
+			t.Fatalf("error running gpg %s: %v", strings.Join(args, " "), err)
+		}
+		return output
+	}
+	gpg("--quick-gen-key", email, "ed25519", "sign", "never")
+	fprs := parseFingerprints(string(gpg("--list-keys", "--with-colons", email)))
+	gpg("--quick-add-key", fprs[0], "cv25519", "encr", "never")
+	fprs = parseFingerprints(string(gpg("--list-keys", "--with-colons", email)))
+	return gpg("--export", "--armor", email), fprs[0], fprs[1]
+}
+
+// parseFingerprints returns every fingerprint within gpg's --with-colons output, be it of a key or a subkey.
+func parseFingerprints(colons string) []string {
+	var fprs []string
+	for _, line := range strings.Split(colons, "\n") {
+		if fields := strings.Split(line, ":"); len(fields) > 9 && fields[0] == "fpr" {
+			fprs = append(fprs, fields[9])
+		}
+	}
+	return fprs
+}
+
+func TestKeyFingerprint(t *testing.T) {
+	if _, err := exec.LookPath("gpg"); err != nil {
+		t.Skip("gpg isn't installed")
+	}
+	t.Setenv("GNUPGHOME", t.TempDir())
+	key, fpr, subFpr := genKey(t, "vendor@example.com")
+	other, _, _ := genKey(t, "attacker@example.com")
+	dir := t.TempDir()
+	write := func(name string, contents []byte) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, contents, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	single, bundled := write("single.asc", key), write("bundled.asc", append(append([]byte{}, key...), other...))
+
+	tests := []struct {
+		name    string
+		key     Key
+		wantErr string
+	}{
+		{name: "matching key", key: Key{Path: single, Fingerprint: fpr}},
+		{name: "spaced lowercase fingerprint", key: Key{Path: single, Fingerprint: strings.ToLower(fpr[:20] + " " + fpr[20:])}},
+		{name: "subkey fingerprint", key: Key{Path: single, Fingerprint: subFpr}, wantErr: "fingerprint mismatch"},
+		{name: "extra key bundled alongside", key: Key{Path: bundled, Fingerprint: fpr}, wantErr: "got 2 keys"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.key.fetch(context.Background())
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+
+	t.Run("installed keyring", func(t *testing.T) {
+		defer func(k string) { keyringsDir = k }(keyringsDir)
+		keyringsDir = dir
+		ctx := context.Background()
+		if got := installedKeyring(ctx, "single", fpr); got != single {
+			t.Errorf("expected the installed keyring %s, got %q", single, got)
+		}
+		if got := installedKeyring(ctx, "single", ""); got != single {
+			t.Errorf("expected the installed keyring %s for any fingerprint, got %q", single, got)
+		}
+		if got := installedKeyring(ctx, "single", subFpr); got != "" {
+			t.Errorf("expected no keyring for a subkey's fingerprint, got %q", got)
+		}
+		if got := installedKeyring(ctx, "bundled", fpr); got != "" {
+			t.Errorf("expected no keyring when others are bundled alongside, got %q", got)
+		}
+		if got := installedKeyring(ctx, "missing", fpr); got != "" {
+			t.Errorf("expected no keyring, got %q", got)
+		}
+	})
+}
@@ -0,0 +1,69 @@
+// Package atomicfile writes files such that readers observe either the previous or the new contents, never a partial write.
+package atomicfile
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// syncFile flushes f to disk. Tests substitute it to fail a write partway through.
+var syncFile = (*os.File).Sync
+
+// WriteFile writes data to path via a temporary file in the same directory that's renamed into place.
+// If path is a symlink, the file it points to is replaced instead of the symlink itself.
+func WriteFile(path string, data []byte, perm os.FileMode) error {
+	resolved, err := filepath.EvalSymlinks(path)
+	if err == nil {
+		path = resolved
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("error resolving %s: %w", path, err)
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("error creating temporary file for %s: %w", path, err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if _, err := f.Write(data); err != nil {
+		return fmt.Errorf("error writing temporary file for %s: %w", path, err)
+	}
+	if err := syncFile(f); err != nil {
+		return fmt.Errorf("error syncing temporary file for %s: %w", path, err)
+	}
+	if err := f.Chmod(perm); err != nil {
+		return fmt.Errorf("error setting permission bits for %s: %w", path, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("error closing temporary file for %s: %w", path, err)
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return fmt.Errorf("error renaming temporary file into place at %s: %w", path, err)
+	}
+	return nil
+}
+
+// Symlink creates newname as a symbolic link to oldname, atomically replacing any existing file at newname.
+// Unlike WriteFile, an existing symlink at newname is itself replaced.
+func Symlink(oldname, newname string) error {
+	f, err := os.CreateTemp(filepath.Dir(newname), "."+filepath.Base(newname)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("error reserving temporary name for %s: %w", newname, err)
+	}
+	tmp := f.Name()
+	_ = f.Close()
+	if err := os.Remove(tmp); err != nil {
+		return fmt.Errorf("error reserving temporary name for %s: %w", newname, err)
+	}
+	if err := os.Symlink(oldname, tmp); err != nil {
+		return fmt.Errorf("error writing temporary symlink for %s: %w", newname, err)
+	}
+	if err := os.Rename(tmp, newname); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("error renaming temporary symlink into place at %s: %w", newname, err)
+	}
+	return nil
+}
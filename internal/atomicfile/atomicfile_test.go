@@ -0,0 +1,64 @@
+package atomicfile
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestWriteFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "settle.yaml")
+	if err := os.WriteFile(path, []byte("old\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := WriteFile(path, []byte("new\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(path); string(got) != "new\n" || info.Mode().Perm() != 0o644 {
+		t.Fatalf("got %q with mode %s, want %q with mode 0644", got, info.Mode().Perm(), "new\n")
+	}
+	assertEntries(t, dir, "settle.yaml")
+}
+
+func TestWriteFileFailure(t *testing.T) {
+	defer func(f func(*os.File) error) { syncFile = f }(syncFile)
+	syncFile = func(*os.File) error { return errors.New("disk full") }
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "settle.yaml")
+	if err := os.WriteFile(path, []byte("old\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := WriteFile(path, []byte("new\n"), 0o644); err == nil {
+		t.Fatal("expected an error")
+	}
+	if got, _ := os.ReadFile(path); string(got) != "old\n" {
+		t.Fatalf("expected the original contents to survive, got %q", got)
+	}
+	assertEntries(t, dir, "settle.yaml")
+}
+
+// assertEntries fails t unless dir contains exactly the named entries, such as when a temporary file was left behind.
+func assertEntries(t *testing.T, dir string, names ...string) {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, e := range entries {
+		got = append(got, e.Name())
+	}
+	if !reflect.DeepEqual(got, names) {
+		t.Fatalf("got entries %v, want %v", got, names)
+	}
+}
@@ -4,25 +4,64 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"io"
-	"net/http"
 	"os"
-	"os/exec"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
+
+	"github.com/danielmmetz/settle/internal/plan"
+	"github.com/danielmmetz/settle/internal/stream"
 )
 
 type Brew struct {
 	Taps  Taps  `json:"taps"`
 	Pkgs  Pkgs  `json:"pkgs"`
 	Casks Casks `json:"casks"`
+	// CaskArgs are the default arguments of every cask, e.g. appdir: ~/Applications.
+	CaskArgs Args `json:"cask_args,omitempty"`
+	// Mas are Mac App Store apps, installed with mas.
+	Mas []MasApp `json:"mas,omitempty"`
+	// Whalebrew are Docker images installed as commands with whalebrew, e.g. whalebrew/wget.
+	Whalebrew []string `json:"whalebrew,omitempty"`
+	// VSCode are Visual Studio Code extensions, e.g. golang.go.
+	VSCode []string `json:"vscode,omitempty"`
+	// Installer is the install script used to install brew if it isn't already. It defaults to the latest official one.
+	Installer *Installer `json:"installer,omitempty"`
+	// Cleanup controls what becomes of installed packages that aren't declared. See the Cleanup constants.
+	Cleanup Cleanup `json:"cleanup,omitempty"`
+	// Ignore lists formulae, casks, and taps that cleanup never removes, despite not being declared, along with their dependencies.
+	// Formulae and casks from taps are best listed by their full names, e.g. owner/tap/name, such that their taps are kept too.
+	Ignore []string `json:"ignore,omitempty"`
+}
+
+func (b *Brew) UnmarshalJSON(data []byte) error {
+	type brew Brew
+	var intermediary brew
+	if err := json.Unmarshal(data, &intermediary); err != nil {
+		return err
+	}
+	switch intermediary.Cleanup {
+	case "":
+		intermediary.Cleanup = CleanupForce
+	case CleanupForce, CleanupPrompt, CleanupReport, CleanupOff:
+	default:
+		return fmt.Errorf("invalid cleanup policy %q: expected %q, %q, %q, or %q", intermediary.Cleanup, CleanupForce, CleanupPrompt, CleanupReport, CleanupOff)
+	}
+	*b = Brew(intermediary)
+	return nil
 }
 
 func (b *Brew) Ensure(ctx context.Context) error {
 	if b == nil {
 		return nil
 	}
+	b = b.forPlatform()
 
-	if err := ensureBrew(ctx); err != nil {
+	if plan.Enabled(ctx) {
+		return b.plan(ctx)
+	}
+	if err := b.Installer.ensure(ctx); err != nil {
 		return fmt.Errorf("error ensuring brew is installed: %w", err)
 	}
 
@@ -37,56 +76,74 @@ func (b *Brew) Ensure(ctx context.Context) error {
 	}
 
 	fmt.Println("installing packages with `brew bundle`")
-	installCmd := exec.CommandContext(ctx, "brew", "bundle", "--file", f.Name())
-	if output, err := installCmd.CombinedOutput(); err != nil {
+	installCmd := command(ctx, "bundle", "--file", f.Name())
+	if output, err := stream.Run(ctx, installCmd); err != nil {
 		return fmt.Errorf("error running `brew bundle`: %w\n%s", err, string(output))
 	}
-	fmt.Println("cleaning up orphan packages with `brew bundle cleanup`")
-	cleanupCmd := exec.CommandContext(ctx, "brew", "bundle", "cleanup", "--force", "--file", f.Name())
-	if output, err := cleanupCmd.CombinedOutput(); err != nil {
-		return fmt.Errorf("error running `brew bundle cleanup`: %w\n%s", err, string(output))
-	}
-	return nil
+	return b.cleanup(ctx)
 }
 
-const brewInstallURL = "https://raw.githubusercontent.com/Homebrew/install/HEAD/install.sh"
-
-func ensureBrew(ctx context.Context) error {
-	if err := exec.CommandContext(ctx, "which", "brew").Run(); err == nil {
+// plan reports the packages `brew bundle` would install and those cleanup would remove.
+func (b *Brew) plan(ctx context.Context) error {
+	if _, ok := Path(); !ok {
+		fmt.Printf("would install brew using the install script from %s, then install all brew packages\n", b.Installer.source())
 		return nil
 	}
 	f, err := os.CreateTemp("", "")
 	if err != nil {
-		return fmt.Errorf("error creating temporary file for brew install script: %w", err)
+		return fmt.Errorf("error creating temporary Brewfile: %w", err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	if _, err := f.WriteString(b.String()); err != nil {
+		return err
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "GET", brewInstallURL, nil)
-	if err != nil {
-		return fmt.Errorf("error building request for brew install script: %w", err)
+	// check exits non-zero when anything is missing, so its output is reported regardless
+	checkCmd := command(ctx, "bundle", "check", "--verbose", "--no-upgrade", "--file", f.Name())
+	output, _ := checkCmd.CombinedOutput()
+	fmt.Printf("`brew bundle check` reports:\n%s", string(output))
+	if b.Cleanup == CleanupOff {
+		return nil
 	}
-	resp, err := http.DefaultClient.Do(req)
+	r, err := b.removable(ctx)
 	if err != nil {
-		return fmt.Errorf("error fetching brew install script: %w", err)
+		return err
 	}
-	defer resp.Body.Close()
-	if _, err := io.Copy(f, resp.Body); err != nil {
-		return fmt.Errorf("error writing brew install script: %w", err)
+	if r.empty() {
+		fmt.Println("no undeclared brew packages to clean up")
+		return nil
 	}
-	_ = f.Close()
-	if err := os.Chmod(f.Name(), 0o755); err != nil {
-		return fmt.Errorf("error setting brew install scipt permission bits: %w", err)
+	if b.Cleanup == CleanupForce {
+		fmt.Println("would remove undeclared brew packages:", r)
+		return nil
 	}
+	fmt.Printf("would report undeclared brew packages, per cleanup: %s: %s\n", b.Cleanup, r)
+	return nil
+}
 
-	cmd := exec.CommandContext(ctx, "bash", "-c", f.Name())
-	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("error installing brew: %w", err)
+// WithPkgs returns a copy of b that additionally installs the named packages.
+func (b *Brew) WithPkgs(names []string) *Brew {
+	merged := *b
+	merged.Pkgs = append(Pkgs(nil), b.Pkgs...)
+	seen := make(map[string]bool)
+	for _, pkg := range b.Pkgs {
+		seen[pkg.Name] = true
 	}
-	return nil
+	for _, name := range names {
+		if !seen[name] {
+			seen[name] = true
+			merged.Pkgs = append(merged.Pkgs, Pkg{Name: name})
+		}
+	}
+	return &merged
 }
 
 func (b *Brew) String() string {
 	var lines []string
+	if len(b.CaskArgs) > 0 {
+		lines = append(lines, "cask_args "+b.CaskArgs.String())
+	}
 	for _, tap := range b.Taps {
 		lines = append(lines, tap.String())
 	}
@@ -96,6 +153,15 @@ func (b *Brew) String() string {
 	for _, cask := range b.Casks {
 		lines = append(lines, cask.String())
 	}
+	for _, app := range b.Mas {
+		lines = append(lines, app.String())
+	}
+	for _, image := range b.Whalebrew {
+		lines = append(lines, fmt.Sprintf("whalebrew %q", image))
+	}
+	for _, extension := range b.VSCode {
+		lines = append(lines, fmt.Sprintf("vscode %q", extension))
+	}
 	return strings.Join(lines, "\n")
 }
 
@@ -109,7 +175,10 @@ func (b *Brew) equal(other Brew) bool {
 	if !b.Casks.equal(other.Casks) {
 		return false
 	}
-	return true
+	return b.CaskArgs.String() == other.CaskArgs.String() &&
+		slices.Equal(b.Mas, other.Mas) &&
+		slices.Equal(b.Whalebrew, other.Whalebrew) &&
+		slices.Equal(b.VSCode, other.VSCode)
 }
 
 type Taps []Tap
@@ -149,14 +218,14 @@ func (t *Taps) UnmarshalJSON(b []byte) error {
 
 type Tap struct {
 	Repo string `json:"repo"`
-	URL  string `json:"url"`
+	URL  string `json:"url,omitempty"`
 }
 
 func (t Tap) String() string {
 	if t.URL == "" {
-		return fmt.Sprintf(`tap "%s"`, t.Repo)
+		return fmt.Sprintf("tap %q", t.Repo)
 	}
-	return fmt.Sprintf(`tap "%s", "%s"`, t.Repo, t.URL)
+	return fmt.Sprintf("tap %q, %q", t.Repo, t.URL)
 }
 
 type Pkgs []Pkg
@@ -197,23 +266,78 @@ func (p *Pkgs) UnmarshalJSON(b []byte) error {
 type Pkg struct {
 	Name string   `json:"name"`
 	Args []string `json:"args,omitempty"`
+	// RestartService restarts the formula's service with `brew services` after installing it. See the RestartService constants.
+	RestartService RestartService `json:"restart_service,omitempty"`
+	// Link overrides whether the formula is linked into the brew prefix, e.g. false for keg-only installs of linked formulae.
+	Link *bool `json:"link,omitempty"`
+	// ConflictsWith are formulae to unlink before linking this one.
+	ConflictsWith []string `json:"conflicts_with,omitempty"`
 }
 
 func (p Pkg) String() string {
 	var sb strings.Builder
 	sb.WriteString(fmt.Sprintf("brew %q", p.Name))
 	if len(p.Args) > 0 {
-		sb.WriteString(", args: [")
-		var arrayEntries []string
-		for _, arg := range p.Args {
-			arrayEntries = append(arrayEntries, fmt.Sprintf("%q", arg))
-		}
-		sb.WriteString(strings.Join(arrayEntries, ","))
-		sb.WriteString("]")
+		sb.WriteString(", args: ")
+		sb.WriteString(quotedList(p.Args))
+	}
+	switch p.RestartService {
+	case RestartAlways:
+		sb.WriteString(", restart_service: true")
+	case RestartChanged:
+		sb.WriteString(", restart_service: :changed")
+	}
+	if p.Link != nil {
+		sb.WriteString(fmt.Sprintf(", link: %t", *p.Link))
+	}
+	if len(p.ConflictsWith) > 0 {
+		sb.WriteString(", conflicts_with: ")
+		sb.WriteString(quotedList(p.ConflictsWith))
 	}
 	return sb.String()
 }
 
+func quotedList(values []string) string {
+	var arrayEntries []string
+	for _, value := range values {
+		arrayEntries = append(arrayEntries, fmt.Sprintf("%q", value))
+	}
+	return "[" + strings.Join(arrayEntries, ",") + "]"
+}
+
+// RestartService is when a formula's service is restarted.
+type RestartService string
+
+const (
+	// RestartAlways restarts the service on every run.
+	RestartAlways RestartService = "always"
+	// RestartChanged restarts the service only if the formula was installed or upgraded.
+	RestartChanged RestartService = "changed"
+)
+
+// UnmarshalJSON accepts true as RestartAlways and false as not restarting, as the Brewfile DSL does.
+func (r *RestartService) UnmarshalJSON(b []byte) error {
+	var restart bool
+	if err := json.Unmarshal(b, &restart); err == nil {
+		*r = ""
+		if restart {
+			*r = RestartAlways
+		}
+		return nil
+	}
+	var intermediary string
+	if err := json.Unmarshal(b, &intermediary); err != nil {
+		return err
+	}
+	switch RestartService(intermediary) {
+	case "", RestartAlways, RestartChanged:
+	default:
+		return fmt.Errorf("invalid restart_service %q: expected true, %q, or %q", intermediary, RestartAlways, RestartChanged)
+	}
+	*r = RestartService(intermediary)
+	return nil
+}
+
 type Casks []Cask
 
 func (c Casks) equal(other Casks) bool {
@@ -240,15 +364,86 @@ func (t *Casks) UnmarshalJSON(b []byte) error {
 	}
 	seen := map[string]bool{}
 	for _, cask := range intermediary {
-		if seen[string(cask)] {
-			return fmt.Errorf("error: contains duplicate tap %s", string(cask))
+		if seen[cask.Name] {
+			return fmt.Errorf("error: contains duplicate cask %s", cask.Name)
 		}
-		seen[string(cask)] = true
+		seen[cask.Name] = true
 	}
 	*t = intermediary
 	return nil
 }
 
-type Cask string
+// Cask is a cask, which may be specified as either a bare name or a mapping.
+type Cask struct {
+	Name string `json:"name"`
+	// Args are the cask's arguments, which take precedence over the stanza's cask_args, e.g. appdir: ~/Applications.
+	Args Args `json:"args,omitempty"`
+}
+
+func (c *Cask) UnmarshalJSON(b []byte) error {
+	var name string
+	if err := json.Unmarshal(b, &name); err == nil {
+		*c = Cask{Name: name}
+		return nil
+	}
+	type cask Cask
+	var intermediary cask
+	if err := json.Unmarshal(b, &intermediary); err != nil {
+		return err
+	}
+	if intermediary.Name == "" {
+		return fmt.Errorf("cask must specify a name")
+	}
+	*c = Cask(intermediary)
+	return nil
+}
+
+func (c Cask) MarshalJSON() ([]byte, error) {
+	if len(c.Args) == 0 {
+		return json.Marshal(c.Name)
+	}
+	type cask Cask
+	return json.Marshal(cask(c))
+}
+
+func (c Cask) String() string {
+	if len(c.Args) == 0 {
+		return fmt.Sprintf("cask %q", c.Name)
+	}
+	return fmt.Sprintf("cask %q, args: { %s }", c.Name, c.Args)
+}
+
+// Args are keyword arguments of casks, e.g. appdir: ~/Applications or require_sha: true.
+// Values are strings, booleans, or numbers.
+type Args map[string]any
+
+// String renders a in the Brewfile DSL, ordered by key, e.g. `appdir: "~/Applications", require_sha: true`.
+func (a Args) String() string {
+	keys := make([]string, 0, len(a))
+	for key := range a {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var entries []string
+	for _, key := range keys {
+		var value string
+		switch v := a[key].(type) {
+		case string:
+			value = fmt.Sprintf("%q", v)
+		case float64:
+			value = strconv.FormatFloat(v, 'f', -1, 64)
+		default:
+			value = fmt.Sprint(v)
+		}
+		entries = append(entries, fmt.Sprintf("%s: %s", key, value))
+	}
+	return strings.Join(entries, ", ")
+}
+
+// MasApp is a Mac App Store app, identified by its ID, e.g. 497799835 for Xcode.
+type MasApp struct {
+	Name string `json:"name"`
+	ID   int    `json:"id"`
+}
 
-func (c Cask) String() string { return fmt.Sprintf(`cask "%s"`, string(c)) }
+func (m MasApp) String() string { return fmt.Sprintf("mas %q, id: %d", m.Name, m.ID) }
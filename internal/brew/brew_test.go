@@ -0,0 +1,80 @@
+package brew
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update the golden Brewfiles in testdata")
+
+func TestString(t *testing.T) {
+	noLink := false
+	tests := []struct {
+		name string
+		brew Brew
+	}{
+		{
+			name: "basic",
+			brew: Brew{
+				Taps:  Taps{{Repo: "homebrew/cask-fonts"}, {Repo: "owner/tap", URL: "https://example.com/tap.git"}},
+				Pkgs:  Pkgs{{Name: "ripgrep"}, {Name: "vim", Args: []string{"HEAD"}}},
+				Casks: Casks{{Name: "iterm2"}},
+			},
+		},
+		{
+			name: "full",
+			brew: Brew{
+				CaskArgs: Args{"appdir": "~/Applications", "require_sha": true},
+				Taps:     Taps{{Repo: "homebrew/services"}},
+				Pkgs: Pkgs{
+					{Name: "postgresql@16", RestartService: RestartChanged, Link: &noLink, ConflictsWith: []string{"postgresql@15", "postgresql@14"}},
+					{Name: "redis", RestartService: RestartAlways},
+				},
+				Casks: Casks{
+					{Name: "firefox", Args: Args{"appdir": "/Applications"}},
+					{Name: "iterm2"},
+				},
+				Mas:       []MasApp{{Name: "Xcode", ID: 497799835}},
+				Whalebrew: []string{"whalebrew/wget"},
+				VSCode:    []string{"golang.go"},
+			},
+		},
+		{
+			name: "quoting",
+			brew: Brew{
+				Casks: Casks{{Name: `odd"cask`}},
+				Mas:   []MasApp{{Name: `Say "Hello"`, ID: 1}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			golden := filepath.Join("testdata", tt.name+".Brewfile")
+			got := tt.brew.String() + "\n"
+			if *update {
+				if err := os.WriteFile(golden, []byte(got), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("error reading golden file: %v", err)
+			}
+			if got != string(want) {
+				t.Fatalf("Brewfile differs from %s:\ngot:\n%s\nwant:\n%s", golden, got, want)
+			}
+
+			// the generated Brewfile parses back into the same stanza
+			parsed, err := ParseBrewfile(strings.NewReader(got))
+			if err != nil {
+				t.Fatalf("error parsing generated Brewfile: %v", err)
+			}
+			if parsed.String() != tt.brew.String() {
+				t.Fatalf("parsed Brewfile differs:\ngot:\n%s\nwant:\n%s", parsed.String(), tt.brew.String())
+			}
+		})
+	}
+}
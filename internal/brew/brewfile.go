@@ -0,0 +1,199 @@
+package brew
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Dump returns the taps, packages, and casks currently installed, as reported by `brew bundle dump`.
+func Dump(ctx context.Context) (*Brew, error) {
+	output, err := command(ctx, "bundle", "dump", "--file=-").Output()
+	if err != nil {
+		return nil, fmt.Errorf("error running `brew bundle dump`: %w", err)
+	}
+	b, err := ParseBrewfile(strings.NewReader(string(output)))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing `brew bundle dump` output: %w", err)
+	}
+	return &b, nil
+}
+
+// ParseBrewfile parses the subset of the Brewfile DSL that Brew is able to represent.
+// Lines for unsupported entry types are skipped.
+func ParseBrewfile(r io.Reader) (Brew, error) {
+	var b Brew
+	scanner := bufio.NewScanner(r)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		kind, rest, _ := strings.Cut(line, " ")
+		args, err := brewfileArgs(rest)
+		if err != nil {
+			return Brew{}, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		if kind == "cask_args" {
+			if b.CaskArgs == nil {
+				b.CaskArgs = make(Args)
+			}
+			for key, value := range args.scalars {
+				b.CaskArgs[key] = value
+			}
+			continue
+		}
+		if len(args.positional) == 0 {
+			continue
+		}
+		switch kind {
+		case "tap":
+			tap := Tap{Repo: args.positional[0]}
+			if len(args.positional) > 1 {
+				tap.URL = args.positional[1]
+			}
+			b.Taps = append(b.Taps, tap)
+		case "brew":
+			pkg := Pkg{Name: args.positional[0], Args: args.lists["args"], ConflictsWith: args.lists["conflicts_with"]}
+			switch args.scalars["restart_service"] {
+			case true:
+				pkg.RestartService = RestartAlways
+			case ":changed":
+				pkg.RestartService = RestartChanged
+			}
+			if link, ok := args.scalars["link"].(bool); ok {
+				pkg.Link = &link
+			}
+			b.Pkgs = append(b.Pkgs, pkg)
+		case "cask":
+			b.Casks = append(b.Casks, Cask{Name: args.positional[0], Args: args.hashes["args"]})
+		case "mas":
+			id, ok := args.scalars["id"].(int)
+			if !ok {
+				return Brew{}, fmt.Errorf("line %d: mas app %s must specify an id", lineNo, args.positional[0])
+			}
+			b.Mas = append(b.Mas, MasApp{Name: args.positional[0], ID: id})
+		case "whalebrew":
+			b.Whalebrew = append(b.Whalebrew, args.positional[0])
+		case "vscode":
+			b.VSCode = append(b.VSCode, args.positional[0])
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return Brew{}, fmt.Errorf("error reading Brewfile: %w", err)
+	}
+	return b, nil
+}
+
+type brewfileArguments struct {
+	positional []string
+	lists      map[string][]string
+	// scalars are keyword arguments with single values: strings if quoted or symbols, otherwise booleans or integers.
+	scalars map[string]any
+	hashes  map[string]Args
+}
+
+// brewfileArgs parses the arguments of a single Brewfile entry,
+// e.g. `"name", args: ["HEAD"]`.
+func brewfileArgs(s string) (brewfileArguments, error) {
+	args := brewfileArguments{lists: make(map[string][]string), scalars: make(map[string]any), hashes: make(map[string]Args)}
+	for s = strings.TrimSpace(s); s != ""; s = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(s), ",")) {
+		if strings.HasPrefix(s, "#") {
+			break
+		}
+		if s[0] == '"' || s[0] == '\'' {
+			value, rest, err := brewfileString(s)
+			if err != nil {
+				return brewfileArguments{}, err
+			}
+			args.positional = append(args.positional, value)
+			s = rest
+			continue
+		}
+
+		key, rest, ok := strings.Cut(s, ":")
+		if !ok {
+			return brewfileArguments{}, fmt.Errorf("unable to parse %q", s)
+		}
+		key = strings.TrimSpace(key)
+		rest = strings.TrimSpace(rest)
+		switch {
+		case strings.HasPrefix(rest, "["):
+			end := strings.Index(rest, "]")
+			if end == -1 {
+				return brewfileArguments{}, fmt.Errorf("unterminated list for %s", key)
+			}
+			inner := strings.TrimSpace(rest[1:end])
+			values := []string{}
+			for inner != "" {
+				value, remainder, err := brewfileString(inner)
+				if err != nil {
+					return brewfileArguments{}, fmt.Errorf("list for %s: %w", key, err)
+				}
+				values = append(values, value)
+				inner = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(remainder), ","))
+			}
+			args.lists[key] = values
+			s = rest[end+1:]
+		case strings.HasPrefix(rest, "{"):
+			end := strings.Index(rest, "}")
+			if end == -1 {
+				return brewfileArguments{}, fmt.Errorf("unterminated hash for %s", key)
+			}
+			inner, err := brewfileArgs(rest[1:end])
+			if err != nil {
+				return brewfileArguments{}, fmt.Errorf("hash for %s: %w", key, err)
+			}
+			args.hashes[key] = inner.scalars
+			s = rest[end+1:]
+		case strings.HasPrefix(rest, `"`) || strings.HasPrefix(rest, "'"):
+			value, remainder, err := brewfileString(rest)
+			if err != nil {
+				return brewfileArguments{}, fmt.Errorf("value for %s: %w", key, err)
+			}
+			args.scalars[key] = value
+			s = remainder
+		default:
+			// bare values such as `true`, `497799835`, or `:changed`
+			value, remainder, _ := strings.Cut(rest, ",")
+			args.scalars[key] = brewfileValue(strings.TrimSpace(value))
+			s = remainder
+		}
+	}
+	return args, nil
+}
+
+// brewfileValue converts a bare value into a boolean or integer, leaving symbols such as :changed as strings.
+func brewfileValue(s string) any {
+	if s == "true" || s == "false" {
+		return s == "true"
+	}
+	if i, err := strconv.Atoi(s); err == nil {
+		return i
+	}
+	return s
+}
+
+// brewfileString parses the quoted string at the start of s, returning the unquoted value and the remainder of s.
+func brewfileString(s string) (string, string, error) {
+	quote := s[0]
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case quote:
+			if quote == '\'' {
+				return strings.ReplaceAll(s[1:i], `\'`, "'"), s[i+1:], nil
+			}
+			value, err := strconv.Unquote(s[:i+1])
+			if err != nil {
+				return "", "", fmt.Errorf("invalid string %s: %w", s[:i+1], err)
+			}
+			return value, s[i+1:], nil
+		}
+	}
+	return "", "", fmt.Errorf("unterminated string %s", s)
+}
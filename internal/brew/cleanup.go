@@ -0,0 +1,190 @@
+package brew
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/danielmmetz/settle/internal/progress"
+	"github.com/danielmmetz/settle/internal/stream"
+)
+
+// Cleanup is a policy for packages that are installed but not declared.
+type Cleanup string
+
+const (
+	// CleanupForce removes them. It's the default.
+	CleanupForce Cleanup = "force"
+	// CleanupPrompt asks before removing them, leaving them be if stdin isn't a terminal.
+	CleanupPrompt Cleanup = "prompt"
+	// CleanupReport lists them without removing them.
+	CleanupReport Cleanup = "report"
+	// CleanupOff leaves them be without checking for them.
+	CleanupOff Cleanup = "off"
+)
+
+// removable are the packages that `brew bundle cleanup` would remove.
+type removable struct {
+	formulae []string
+	casks    []string
+	taps     []string
+}
+
+func (r removable) empty() bool {
+	return len(r.formulae) == 0 && len(r.casks) == 0 && len(r.taps) == 0
+}
+
+func (r removable) String() string {
+	var sections []string
+	for _, section := range []struct {
+		kind  string
+		names []string
+	}{{"formulae", r.formulae}, {"casks", r.casks}, {"taps", r.taps}} {
+		if len(section.names) > 0 {
+			sections = append(sections, fmt.Sprintf("%s: %s", section.kind, strings.Join(section.names, " ")))
+		}
+	}
+	return strings.Join(sections, "; ")
+}
+
+// cleanupBrewfile returns the Brewfile against which cleanup is checked: b's, plus the packages b ignores.
+// Declaring rather than filtering out ignored packages keeps their dependencies and taps too,
+// which brew would otherwise refuse to remove while the ignored packages require them.
+func (b *Brew) cleanupBrewfile() string {
+	lines := []string{b.String()}
+	for _, name := range b.Ignore {
+		switch strings.Count(name, "/") {
+		case 1:
+			lines = append(lines, Tap{Repo: name}.String())
+		case 2:
+			// a formula or cask by its full name, e.g. owner/tap/name, which requires its tap
+			lines = append(lines, Tap{Repo: name[:strings.LastIndex(name, "/")]}.String())
+			fallthrough
+		default:
+			// cleanup merely compares names, so whether it's a formula or a cask needn't be known
+			lines = append(lines, Pkg{Name: name}.String(), Cask{Name: name}.String())
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// removable returns what `brew bundle cleanup` would remove, given b's Brewfile plus the packages b ignores.
+func (b *Brew) removable(ctx context.Context) (removable, error) {
+	f, err := os.CreateTemp("", "")
+	if err != nil {
+		return removable{}, fmt.Errorf("error creating temporary Brewfile for cleanup: %w", err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	if _, err := f.WriteString(b.cleanupBrewfile()); err != nil {
+		return removable{}, fmt.Errorf("error writing temporary Brewfile for cleanup: %w", err)
+	}
+
+	// without --force, cleanup only lists what it would remove, exiting non-zero if there's anything to list
+	output, err := command(ctx, "bundle", "cleanup", "--file", f.Name()).Output()
+	if err == nil {
+		return parseRemovable(string(output)), nil
+	}
+	exitErr := (*exec.ExitError)(nil)
+	if !errors.As(err, &exitErr) {
+		return removable{}, fmt.Errorf("error running `brew bundle cleanup`: %w", err)
+	}
+	// it also exits non-zero if it fails outright, as when the Brewfile can't be parsed, in which case there's nothing listed
+	r := parseRemovable(string(output))
+	if r.empty() {
+		return removable{}, fmt.Errorf("error running `brew bundle cleanup`: %w\n%s", err, string(exitErr.Stderr))
+	}
+	return r, nil
+}
+
+// parseRemovable parses what `brew bundle cleanup` lists it would remove.
+func parseRemovable(output string) removable {
+	var r removable
+	var section *[]string
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "Would uninstall formulae:":
+			section = &r.formulae
+		case line == "Would uninstall casks:":
+			section = &r.casks
+		case line == "Would untap:":
+			section = &r.taps
+		case strings.HasSuffix(line, ":") || strings.HasPrefix(line, "Run `brew bundle cleanup"):
+			// sections settle doesn't act upon, such as the cache cleanup performed by `brew cleanup`
+			section = nil
+		case section != nil:
+			*section = append(*section, strings.Fields(line)...)
+		}
+	}
+	return r
+}
+
+// cleanup applies b's cleanup policy to the undeclared packages.
+func (b *Brew) cleanup(ctx context.Context) error {
+	if b.Cleanup == CleanupOff {
+		return nil
+	}
+	r, err := b.removable(ctx)
+	if err != nil {
+		return err
+	}
+	if r.empty() {
+		fmt.Println("no undeclared brew packages to clean up")
+		return nil
+	}
+
+	fmt.Println("undeclared brew packages:", r)
+	switch b.Cleanup {
+	case CleanupReport:
+		fmt.Println("leaving undeclared brew packages installed, per cleanup: report")
+		return nil
+	case CleanupPrompt:
+		if !confirm(ctx, "remove undeclared brew packages?") {
+			fmt.Println("leaving undeclared brew packages installed")
+			return nil
+		}
+	}
+
+	fmt.Println("cleaning up undeclared brew packages")
+	for _, removal := range []struct {
+		args  []string
+		names []string
+	}{
+		{[]string{"uninstall", "--formula"}, r.formulae},
+		{[]string{"uninstall", "--cask"}, r.casks},
+		{[]string{"untap"}, r.taps},
+	} {
+		if len(removal.names) == 0 {
+			continue
+		}
+		removeCmd := command(ctx, append(removal.args, removal.names...)...)
+		if output, err := stream.Run(ctx, removeCmd); err != nil {
+			return fmt.Errorf("error running `brew %s`: %w\n%s", strings.Join(removal.args, " "), err, string(output))
+		}
+	}
+	return nil
+}
+
+// confirm asks question on the terminal, reporting whether the answer was yes.
+func confirm(ctx context.Context, question string) bool {
+	progress.Suspend(ctx)
+	defer progress.Resume(ctx)
+	fi, err := os.Stdin.Stat()
+	if err != nil || fi.Mode()&os.ModeCharDevice == 0 {
+		fmt.Println("unable to prompt: stdin isn't a terminal")
+		return false
+	}
+	fmt.Printf("%s [y/N]\n", question)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	}
+	return false
+}
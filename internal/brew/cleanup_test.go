@@ -0,0 +1,80 @@
+package brew
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCleanupBrewfile(t *testing.T) {
+	b := Brew{
+		Pkgs:   Pkgs{{Name: "ripgrep"}},
+		Ignore: []string{"postgresql@16", "owner/tap", "other/tap/formula"},
+	}
+	want := `brew "ripgrep"
+brew "postgresql@16"
+cask "postgresql@16"
+tap "owner/tap"
+tap "other/tap"
+brew "other/tap/formula"
+cask "other/tap/formula"`
+	if got := b.cleanupBrewfile(); got != want {
+		t.Fatalf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestRemovable(t *testing.T) {
+	tests := []struct {
+		name    string
+		script  string
+		want    removable
+		wantErr string
+	}{
+		{
+			name:   "nothing to remove",
+			script: "exit 0",
+		},
+		{
+			name: "listing",
+			script: "cat <<'LIST'\n" +
+				"Would uninstall formulae:\nhtop\njq\n" +
+				"Would uninstall casks:\nslack\n" +
+				"Would untap:\nowner/tap\n" +
+				"Would `brew cleanup`:\nRemoving: ~/Library/Caches/Homebrew/jq--1.7.bottle.tar.gz\n" +
+				"Run `brew bundle cleanup --force` to make these changes.\n" +
+				"LIST\nexit 1",
+			want: removable{formulae: []string{"htop", "jq"}, casks: []string{"slack"}, taps: []string{"owner/tap"}},
+		},
+		{
+			name:    "failure",
+			script:  "echo 'Error: Invalid Brewfile: unexpected token' >&2\nexit 1",
+			wantErr: "Invalid Brewfile",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(dir, "brew"), []byte("#!/bin/sh\n"+tt.script+"\n"), 0o755); err != nil {
+				t.Fatal(err)
+			}
+			t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+			got, err := (&Brew{}).removable(context.Background())
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
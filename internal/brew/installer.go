@@ -0,0 +1,178 @@
+package brew
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/danielmmetz/settle/internal/progress"
+)
+
+// installerURL is the URL of the official install script, given the commit of github.com/Homebrew/install to fetch it from.
+const installerURL = "https://raw.githubusercontent.com/Homebrew/install/%s/install.sh"
+
+// Installer is the script that installs brew. At most one of Commit, URL, and Path may be set.
+type Installer struct {
+	// Commit pins the official install script to a commit of github.com/Homebrew/install. It defaults to HEAD.
+	Commit string `json:"commit,omitempty"`
+	// URL fetches the install script from elsewhere, e.g. a mirror.
+	URL string `json:"url,omitempty"`
+	// Path reads the install script from a local file. The script itself still clones brew and homebrew-core.
+	Path string `json:"path,omitempty"`
+	// SHA256 is the expected hex-encoded sha256 checksum of the install script, which isn't run unless it matches.
+	SHA256 string `json:"sha256,omitempty"`
+	// BrewGitRemote is the git remote from which the install script clones brew, e.g. a mirror of github.com/Homebrew/brew.
+	BrewGitRemote string `json:"brew_git_remote,omitempty"`
+	// CoreGitRemote is the git remote from which the install script clones homebrew-core.
+	CoreGitRemote string `json:"core_git_remote,omitempty"`
+}
+
+func (i *Installer) UnmarshalJSON(b []byte) error {
+	type installer Installer
+	var intermediary installer
+	if err := json.Unmarshal(b, &intermediary); err != nil {
+		return err
+	}
+	var set []string
+	for _, field := range []struct{ name, value string }{{"commit", intermediary.Commit}, {"url", intermediary.URL}, {"path", intermediary.Path}} {
+		if field.value != "" {
+			set = append(set, field.name)
+		}
+	}
+	if len(set) > 1 {
+		return fmt.Errorf("installer may specify only one of commit, url, and path, got %s", strings.Join(set, " and "))
+	}
+	if intermediary.SHA256 != "" {
+		if decoded, err := hex.DecodeString(intermediary.SHA256); err != nil || len(decoded) != sha256.Size {
+			return fmt.Errorf("invalid installer sha256 %q: expected %d hex characters", intermediary.SHA256, 2*sha256.Size)
+		}
+	}
+	*i = Installer(intermediary)
+	return nil
+}
+
+// source returns the path or URL from which the install script is read.
+func (i *Installer) source() string {
+	switch {
+	case i == nil:
+		return fmt.Sprintf(installerURL, "HEAD")
+	case i.Path != "":
+		return i.Path
+	case i.URL != "":
+		return i.URL
+	case i.Commit != "":
+		return fmt.Sprintf(installerURL, i.Commit)
+	}
+	return fmt.Sprintf(installerURL, "HEAD")
+}
+
+// env returns the environment variables by which the install script is pointed at the configured git remotes.
+func (i *Installer) env() []string {
+	if i == nil {
+		return nil
+	}
+	var env []string
+	if i.BrewGitRemote != "" {
+		env = append(env, "HOMEBREW_BREW_GIT_REMOTE="+i.BrewGitRemote)
+	}
+	if i.CoreGitRemote != "" {
+		env = append(env, "HOMEBREW_CORE_GIT_REMOTE="+i.CoreGitRemote)
+	}
+	return env
+}
+
+// script returns the contents of the install script, fetched with client unless it's a local file,
+// having verified its checksum if one is expected.
+func (i *Installer) script(ctx context.Context, client *http.Client) ([]byte, error) {
+	source := i.source()
+	var contents []byte
+	if i != nil && i.Path != "" {
+		path := i.Path
+		if rest, ok := cutHome(path); ok {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return nil, fmt.Errorf("unable to determine home dir: %w", err)
+			}
+			path = filepath.Join(home, rest)
+		}
+		var err error
+		if contents, err = os.ReadFile(path); err != nil {
+			return nil, fmt.Errorf("error reading brew install script: %w", err)
+		}
+	} else {
+		req, err := http.NewRequestWithContext(ctx, "GET", source, nil)
+		if err != nil {
+			return nil, fmt.Errorf("error building request for brew install script: %w", err)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("error fetching brew install script: %w", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("error fetching brew install script from %s: unexpected status %s", source, resp.Status)
+		}
+		if contents, err = io.ReadAll(resp.Body); err != nil {
+			return nil, fmt.Errorf("error fetching brew install script from %s: %w", source, err)
+		}
+	}
+
+	if i == nil || i.SHA256 == "" {
+		fmt.Println("brew install script is unverified: set installer.sha256 to verify it")
+		return contents, nil
+	}
+	sum := sha256.Sum256(contents)
+	if actual := hex.EncodeToString(sum[:]); !strings.EqualFold(actual, i.SHA256) {
+		return nil, fmt.Errorf("brew install script from %s has sha256 %s, expected %s", source, actual, i.SHA256)
+	}
+	return contents, nil
+}
+
+// ensure installs brew by means of the install script, unless brew is already installed.
+// A nil Installer uses the latest official install script.
+func (i *Installer) ensure(ctx context.Context) error {
+	if _, ok := Path(); ok {
+		return nil
+	}
+	fmt.Println("installing brew using the install script from", i.source())
+	contents, err := i.script(ctx, http.DefaultClient)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp("", "")
+	if err != nil {
+		return fmt.Errorf("error creating temporary file for brew install script: %w", err)
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(contents); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("error writing brew install script: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("error writing brew install script: %w", err)
+	}
+
+	cmd := exec.CommandContext(ctx, "bash", f.Name())
+	cmd.Env = append(os.Environ(), i.env()...)
+	// the install script asks for confirmation on the terminal
+	progress.Suspend(ctx)
+	defer progress.Resume(ctx)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("error installing brew: %w", err)
+	}
+	if _, ok := Path(); !ok {
+		return fmt.Errorf("brew was installed, but it's neither on PATH nor within %s", strings.Join(prefixes[runtime.GOOS], " or "))
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package brew
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testScript = "#!/bin/bash\necho installing brew\n"
+
+func checksum(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestInstallerScript(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/install.sh":
+			_, _ = w.Write([]byte(testScript))
+		case "/error":
+			http.Error(w, "internal error", http.StatusInternalServerError)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	local := filepath.Join(t.TempDir(), "install.sh")
+	if err := os.WriteFile(local, []byte(testScript), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		installer *Installer
+		// wantErr is a substring of the expected error, if any.
+		wantErr string
+	}{
+		{
+			name:      "matching sha256",
+			installer: &Installer{URL: srv.URL + "/install.sh", SHA256: checksum(testScript)},
+		},
+		{
+			name:      "unverified",
+			installer: &Installer{URL: srv.URL + "/install.sh"},
+		},
+		{
+			name:      "mismatched sha256",
+			installer: &Installer{URL: srv.URL + "/install.sh", SHA256: checksum("something else")},
+			wantErr:   "has sha256 " + checksum(testScript),
+		},
+		{
+			name:      "not found",
+			installer: &Installer{URL: srv.URL + "/missing", SHA256: checksum(testScript)},
+			wantErr:   "unexpected status 404",
+		},
+		{
+			name:      "server error",
+			installer: &Installer{URL: srv.URL + "/error", SHA256: checksum(testScript)},
+			wantErr:   "unexpected status 500",
+		},
+		{
+			name:      "local path",
+			installer: &Installer{Path: local, SHA256: checksum(testScript)},
+		},
+		{
+			name:      "local path with mismatched sha256",
+			installer: &Installer{Path: local, SHA256: checksum("something else")},
+			wantErr:   "has sha256",
+		},
+		{
+			name:      "missing local path",
+			installer: &Installer{Path: filepath.Join(t.TempDir(), "missing.sh")},
+			wantErr:   "error reading brew install script",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			contents, err := tt.installer.script(context.Background(), srv.Client())
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if string(contents) != testScript {
+				t.Fatalf("expected script %q, got %q", testScript, contents)
+			}
+		})
+	}
+}
+
+func TestInstallerEnv(t *testing.T) {
+	i := &Installer{BrewGitRemote: "https://mirror.example/brew.git", CoreGitRemote: "https://mirror.example/core.git"}
+	got := strings.Join(i.env(), " ")
+	want := "HOMEBREW_BREW_GIT_REMOTE=https://mirror.example/brew.git HOMEBREW_CORE_GIT_REMOTE=https://mirror.example/core.git"
+	if got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+	if env := (*Installer)(nil).env(); env != nil {
+		t.Fatalf("expected no env for the default installer, got %v", env)
+	}
+}
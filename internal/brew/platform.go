@@ -0,0 +1,93 @@
+package brew
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// linuxPrefix is where the installer puts brew on Linux, which isn't on PATH until `brew shellenv` is evaluated.
+const linuxPrefix = "/home/linuxbrew/.linuxbrew"
+
+// prefixes are the locations in which brew may be installed, by platform, in order of preference.
+var prefixes = map[string][]string{
+	"darwin": {"/opt/homebrew", "/usr/local"},
+	"linux":  {linuxPrefix, "~/.linuxbrew"},
+}
+
+// Path returns the path of the brew binary, reporting false if brew isn't installed.
+// brew is looked for on PATH, then within its usual prefixes, such that it's found right after being installed.
+func Path() (string, bool) {
+	if path, err := exec.LookPath("brew"); err == nil {
+		return path, true
+	}
+	home, _ := os.UserHomeDir()
+	for _, prefix := range prefixes[runtime.GOOS] {
+		if rest, ok := cutHome(prefix); ok {
+			if home == "" {
+				continue
+			}
+			prefix = filepath.Join(home, rest)
+		}
+		path := filepath.Join(prefix, "bin", "brew")
+		if info, err := os.Stat(path); err == nil && info.Mode()&0o111 != 0 {
+			return path, true
+		}
+	}
+	return "", false
+}
+
+func cutHome(path string) (string, bool) {
+	return strings.CutPrefix(path, "~/")
+}
+
+// ShellEnv returns the .zshrc line that puts brew on PATH, or an empty string if none is needed, as on macOS.
+func ShellEnv() string {
+	if runtime.GOOS != "linux" {
+		return ""
+	}
+	path, ok := Path()
+	if !ok {
+		// not yet installed, so it'll be installed to the default prefix
+		path = filepath.Join(linuxPrefix, "bin", "brew")
+	}
+	return fmt.Sprintf(`eval "$(%s shellenv)"`, path)
+}
+
+// command returns a command that runs brew with args, wherever brew is installed.
+func command(ctx context.Context, args ...string) *exec.Cmd {
+	path, ok := Path()
+	if !ok {
+		path = "brew"
+	}
+	return exec.CommandContext(ctx, path, args...)
+}
+
+// forPlatform returns b less the entries that are unavailable on the running platform, warning of those skipped.
+// Casks and Mac App Store apps are available only on macOS.
+func (b *Brew) forPlatform() *Brew {
+	if runtime.GOOS == "darwin" || (len(b.Casks) == 0 && len(b.Mas) == 0) {
+		return b
+	}
+	if len(b.Casks) > 0 {
+		var names []string
+		for _, cask := range b.Casks {
+			names = append(names, cask.Name)
+		}
+		fmt.Printf("skipping casks, which are unavailable on %s: %s\n", runtime.GOOS, strings.Join(names, " "))
+	}
+	if len(b.Mas) > 0 {
+		var names []string
+		for _, app := range b.Mas {
+			names = append(names, app.Name)
+		}
+		fmt.Printf("skipping Mac App Store apps, which are unavailable on %s: %s\n", runtime.GOOS, strings.Join(names, " "))
+	}
+	supported := *b
+	supported.Casks, supported.CaskArgs, supported.Mas = nil, nil, nil
+	return &supported
+}
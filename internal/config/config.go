@@ -3,18 +3,27 @@ package config
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"time"
 
+	"github.com/danielmmetz/settle/internal/apk"
 	"github.com/danielmmetz/settle/internal/apt"
+	"github.com/danielmmetz/settle/internal/atomicfile"
 	"github.com/danielmmetz/settle/internal/brew"
+	"github.com/danielmmetz/settle/internal/dnf"
 	"github.com/danielmmetz/settle/internal/files"
+	"github.com/danielmmetz/settle/internal/journal"
 	"github.com/danielmmetz/settle/internal/nvim"
+	"github.com/danielmmetz/settle/internal/packages"
 	"github.com/danielmmetz/settle/internal/pacman"
+	"github.com/danielmmetz/settle/internal/progress"
+	"github.com/danielmmetz/settle/internal/stream"
 	"github.com/danielmmetz/settle/internal/zsh"
+	"github.com/danielmmetz/settle/internal/zypper"
 	"github.com/ghodss/yaml"
 	"github.com/peterbourgon/ff/v3"
 )
@@ -66,7 +75,7 @@ func WriteBackup(c Config) error {
 	}
 
 	_ = os.MkdirAll(filepath.Join(home, ".config", "settle"), 0o755)
-	err = os.WriteFile(
+	err = atomicfile.WriteFile(
 		filepath.Join(home, ".config", "settle", "settings.yaml"),
 		settingsBytes,
 		0o644,
@@ -76,7 +85,7 @@ func WriteBackup(c Config) error {
 	}
 	xdgDataDir := filepath.Join(home, ".local", "share")
 	_ = os.MkdirAll(filepath.Join(xdgDataDir, "settle"), 0o755)
-	err = os.WriteFile(
+	err = atomicfile.WriteFile(
 		filepath.Join(home, ".local", "share", "settle", fmt.Sprintf("%s.yaml", time.Now().Local().Format("2006-01-02 15:04:05"))),
 		c.YAML(),
 		0o644,
@@ -88,12 +97,16 @@ func WriteBackup(c Config) error {
 }
 
 type Config struct {
-	Files  *files.Files   `json:"files"`
-	Brew   *brew.Brew     `json:"brew"`
-	Apt    *apt.Apt       `json:"apt"`
-	Pacman *pacman.Pacman `json:"pacman"`
-	Nvim   *nvim.Nvim     `json:"nvim"`
-	Zsh    *zsh.Zsh       `json:"zsh"`
+	Files    *files.Files       `json:"files,omitempty"`
+	Brew     *brew.Brew         `json:"brew,omitempty"`
+	Apt      *apt.Apt           `json:"apt,omitempty"`
+	Pacman   *pacman.Pacman     `json:"pacman,omitempty"`
+	Dnf      *dnf.Dnf           `json:"dnf,omitempty"`
+	Apk      *apk.Apk           `json:"apk,omitempty"`
+	Zypper   *zypper.Zypper     `json:"zypper,omitempty"`
+	Packages *packages.Packages `json:"packages,omitempty"`
+	Nvim     *nvim.Nvim         `json:"nvim,omitempty"`
+	Zsh      *zsh.Zsh           `json:"zsh,omitempty"`
 
 	// absPath is the absolute path to where config exists on disk.
 	absPath string
@@ -101,13 +114,17 @@ type Config struct {
 
 func (c *Config) UnmarshalJSON(b []byte) error {
 	type clone struct {
-		Includes []string       `json:"includes"`
-		Files    *files.Files   `json:"files"`
-		Brew     *brew.Brew     `json:"brew"`
-		Apt      *apt.Apt       `json:"apt"`
-		Pacman   *pacman.Pacman `json:"pacman"`
-		Nvim     *nvim.Nvim     `json:"nvim"`
-		Zsh      *zsh.Zsh       `json:"zsh"`
+		Includes []string           `json:"includes"`
+		Files    *files.Files       `json:"files"`
+		Brew     *brew.Brew         `json:"brew"`
+		Apt      *apt.Apt           `json:"apt"`
+		Pacman   *pacman.Pacman     `json:"pacman"`
+		Dnf      *dnf.Dnf           `json:"dnf"`
+		Apk      *apk.Apk           `json:"apk"`
+		Zypper   *zypper.Zypper     `json:"zypper"`
+		Packages *packages.Packages `json:"packages"`
+		Nvim     *nvim.Nvim         `json:"nvim"`
+		Zsh      *zsh.Zsh           `json:"zsh"`
 	}
 	var original clone
 	if err := json.Unmarshal(b, &original); err != nil {
@@ -137,6 +154,18 @@ func (c *Config) UnmarshalJSON(b []byte) error {
 	if original.Pacman != nil {
 		final.Pacman = original.Pacman
 	}
+	if original.Dnf != nil {
+		final.Dnf = original.Dnf
+	}
+	if original.Apk != nil {
+		final.Apk = original.Apk
+	}
+	if original.Zypper != nil {
+		final.Zypper = original.Zypper
+	}
+	if original.Packages != nil {
+		final.Packages = original.Packages
+	}
 	if original.Nvim != nil {
 		final.Nvim = original.Nvim
 	}
@@ -147,6 +176,9 @@ func (c *Config) UnmarshalJSON(b []byte) error {
 	return nil
 }
 
+// Path returns the absolute path of the config file c was loaded from.
+func (c *Config) Path() string { return c.absPath }
+
 func (c *Config) JSON() []byte {
 	b, _ := json.MarshalIndent(c, "", "  ")
 	return b
@@ -157,24 +189,89 @@ func (c *Config) YAML() []byte {
 	return b
 }
 
+// Ensure applies each stanza of c in turn.
+// If any stanza fails, files generated or symlinked earlier in the run are restored to their prior state.
 func (c *Config) Ensure(ctx context.Context) error {
-	if err := c.Files.Ensure(ctx); err != nil {
-		return fmt.Errorf("error ensuring files: %w", err)
+	j := journal.New()
+	if err := c.ensure(journal.With(ctx, j)); err != nil {
+		restored, restoreErr := j.Restore()
+		for _, path := range restored {
+			fmt.Println("restored", path)
+		}
+		if restoreErr != nil {
+			return errors.Join(err, restoreErr)
+		}
+		return err
 	}
-	if err := c.Apt.Ensure(ctx); err != nil {
-		return fmt.Errorf("error ensuring apt: %w", err)
+	return nil
+}
+
+// stanza is a section of the config that may be ensured.
+type stanza interface {
+	Ensure(ctx context.Context) error
+}
+
+type namedStanza struct {
+	name   string
+	stanza stanza
+}
+
+// stanzas returns the configured stanzas, in the order in which they're ensured.
+func (c *Config) stanzas() []namedStanza {
+	brew, pkgs := c.Brew, c.Packages
+	if brew != nil && pkgs.UsesBrew() {
+		// brew bundle cleanup removes whatever its Brewfile omits, so packages are installed by way of the brew stanza
+		brew, pkgs = brew.WithPkgs(pkgs.NamesFor("brew")), nil
+	}
+	zsh := c.zsh()
+	var stanzas []namedStanza
+	add := func(name string, s stanza, configured bool) {
+		if configured {
+			stanzas = append(stanzas, namedStanza{name: name, stanza: s})
+		}
 	}
-	if err := c.Brew.Ensure(ctx); err != nil {
-		return fmt.Errorf("error ensuring brew: %w", err)
+	add("files", c.Files, c.Files != nil)
+	add("apt", c.Apt, c.Apt != nil)
+	add("brew", brew, brew != nil)
+	add("pacman", c.Pacman, c.Pacman != nil)
+	add("dnf", c.Dnf, c.Dnf != nil)
+	add("apk", c.Apk, c.Apk != nil)
+	add("zypper", c.Zypper, c.Zypper != nil)
+	add("packages", pkgs, pkgs != nil)
+	add("nvim", c.Nvim, c.Nvim != nil)
+	add("zsh", zsh, zsh != nil)
+	return stanzas
+}
+
+// zsh returns the zsh stanza, which evaluates brew's shellenv if brew is configured on Linux,
+// where brew isn't otherwise on PATH.
+func (c *Config) zsh() *zsh.Zsh {
+	if c.Zsh == nil || c.Brew == nil {
+		return c.Zsh
 	}
-	if err := c.Pacman.Ensure(ctx); err != nil {
-		return fmt.Errorf("error ensuring pacman: %w", err)
+	if line := brew.ShellEnv(); line != "" {
+		return c.Zsh.WithShellEnv(line, "brew shellenv")
 	}
-	if err := c.Nvim.Ensure(ctx); err != nil {
-		return fmt.Errorf("error ensuring nvim: %w", err)
+	return c.Zsh
+}
+
+// Stanzas returns the names of the configured stanzas, in the order in which they're ensured.
+func (c *Config) Stanzas() []string {
+	var names []string
+	for _, s := range c.stanzas() {
+		names = append(names, s.name)
 	}
-	if err := c.Zsh.Ensure(ctx); err != nil {
-		return fmt.Errorf("error ensuring zsh: %w", err)
+	return names
+}
+
+func (c *Config) ensure(ctx context.Context) error {
+	for _, s := range c.stanzas() {
+		progress.Begin(ctx, s.name)
+		err := s.stanza.Ensure(stream.With(ctx, s.name))
+		progress.End(ctx, s.name, err)
+		if err != nil {
+			return fmt.Errorf("error ensuring %s: %w", s.name, err)
+		}
 	}
 	return nil
 }
@@ -191,6 +288,14 @@ func OptionFrom(target string) Option {
 		return OnlyBrew()
 	case "pacman":
 		return OnlyPacman()
+	case "dnf":
+		return OnlyDnf()
+	case "apk":
+		return OnlyApk()
+	case "zypper":
+		return OnlyZypper()
+	case "packages":
+		return OnlyPackages()
 	case "files":
 		return OnlyFiles()
 	case "nvim":
@@ -202,9 +307,11 @@ func OptionFrom(target string) Option {
 	}
 }
 
+// OnlyBrew narrows c to the brew stanza.
+// Packages installed with brew are kept, since they're part of the Brewfile brew bundle cleanup compares against.
 func OnlyBrew() Option {
 	return func(c *Config) {
-		*c = Config{Brew: c.Brew}
+		*c = Config{Brew: c.Brew, Packages: c.brewPackages()}
 	}
 }
 
@@ -214,6 +321,48 @@ func OnlyPacman() Option {
 	}
 }
 
+func OnlyDnf() Option {
+	return func(c *Config) {
+		*c = Config{Dnf: c.Dnf}
+	}
+}
+
+func OnlyApk() Option {
+	return func(c *Config) {
+		*c = Config{Apk: c.Apk}
+	}
+}
+
+func OnlyZypper() Option {
+	return func(c *Config) {
+		*c = Config{Zypper: c.Zypper}
+	}
+}
+
+// OnlyPackages narrows c to the packages stanza.
+// If the packages are installed with brew, the brew stanza is kept too, since it's what installs them.
+func OnlyPackages() Option {
+	return func(c *Config) {
+		*c = Config{Brew: c.packagesBrew(), Packages: c.Packages}
+	}
+}
+
+// brewPackages returns c.Packages if they're installed by way of the brew stanza.
+func (c *Config) brewPackages() *packages.Packages {
+	if c.Brew != nil && c.Packages.UsesBrew() {
+		return c.Packages
+	}
+	return nil
+}
+
+// packagesBrew returns c.Brew if c.Packages are installed by way of it.
+func (c *Config) packagesBrew() *brew.Brew {
+	if c.brewPackages() != nil {
+		return c.Brew
+	}
+	return nil
+}
+
 func OnlyFiles() Option {
 	return func(c *Config) {
 		*c = Config{Files: c.Files}
@@ -228,7 +377,8 @@ func OnlyNvim() Option {
 
 func OnlyZsh() Option {
 	return func(c *Config) {
-		*c = Config{Zsh: c.Zsh}
+		// the brew stanza is dropped, but not its shellenv
+		*c = Config{Zsh: c.zsh()}
 	}
 }
 
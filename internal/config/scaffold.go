@@ -0,0 +1,129 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/danielmmetz/settle/internal/apk"
+	"github.com/danielmmetz/settle/internal/apt"
+	"github.com/danielmmetz/settle/internal/brew"
+	"github.com/danielmmetz/settle/internal/dnf"
+	"github.com/danielmmetz/settle/internal/files"
+	"github.com/danielmmetz/settle/internal/pacman"
+	"github.com/danielmmetz/settle/internal/zsh"
+	"github.com/danielmmetz/settle/internal/zypper"
+)
+
+// Scaffold builds a Config describing the current machine, to be used as the starting point for a new config.
+// Package managers that aren't installed are skipped.
+// If copyDotfiles is true, dotfiles found in the home directory are copied into dir
+// and included as files mappings so that a subsequent run symlinks them back into place.
+func Scaffold(ctx context.Context, dir string, copyDotfiles bool) (Config, error) {
+	var c Config
+	var err error
+
+	if _, ok := brew.Path(); ok {
+		fmt.Println("inspecting brew packages")
+		if c.Brew, err = brew.Dump(ctx); err != nil {
+			return Config{}, err
+		}
+	}
+	if _, lookErr := exec.LookPath("apt-mark"); lookErr == nil {
+		fmt.Println("inspecting apt packages")
+		if c.Apt, err = apt.Current(ctx); err != nil {
+			return Config{}, err
+		}
+	}
+	if _, lookErr := exec.LookPath("pacman"); lookErr == nil {
+		fmt.Println("inspecting pacman packages")
+		if c.Pacman, err = pacman.Current(ctx); err != nil {
+			return Config{}, err
+		}
+	}
+	if _, lookErr := exec.LookPath("dnf"); lookErr == nil {
+		fmt.Println("inspecting dnf packages")
+		if c.Dnf, err = dnf.Current(ctx); err != nil {
+			return Config{}, err
+		}
+	}
+	if _, lookErr := exec.LookPath("apk"); lookErr == nil {
+		fmt.Println("inspecting apk packages")
+		if c.Apk, err = apk.Current(ctx); err != nil {
+			return Config{}, err
+		}
+	}
+	if _, lookErr := exec.LookPath("zypper"); lookErr == nil {
+		fmt.Println("inspecting zypper packages")
+		if c.Zypper, err = zypper.Current(ctx); err != nil {
+			return Config{}, err
+		}
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return Config{}, fmt.Errorf("unable to determine home dir: %w", err)
+	}
+	rc, err := os.ReadFile(filepath.Join(home, ".zshrc"))
+	if err == nil {
+		fmt.Println("parsing .zshrc")
+		c.Zsh = zsh.Parse(string(rc))
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return Config{}, fmt.Errorf("error reading .zshrc: %w", err)
+	}
+
+	if !copyDotfiles {
+		return c, nil
+	}
+	discovered, err := files.Discover(home)
+	if err != nil {
+		return Config{}, fmt.Errorf("error discovering dotfiles: %w", err)
+	}
+	var mappings files.Files
+	for _, m := range discovered {
+		if m.Dst == filepath.Join("~", ".zshrc") && c.Zsh != nil {
+			// generated from the zsh stanza instead
+			continue
+		}
+		if !filepath.IsAbs(m.Src) {
+			if err := copyDotfile(filepath.Join(home, filepath.Base(m.Dst)), filepath.Join(dir, m.Src)); err != nil {
+				return Config{}, err
+			}
+		}
+		mappings = append(mappings, m)
+	}
+	if len(mappings) > 0 {
+		c.Files = &mappings
+	}
+	return c, nil
+}
+
+func copyDotfile(src, dst string) error {
+	if _, err := os.Lstat(dst); err == nil {
+		fmt.Println("file exists, not overwriting it:", dst)
+		return nil
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("error opening %s: %w", src, err)
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return fmt.Errorf("error reading file info for %s: %w", src, err)
+	}
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return fmt.Errorf("error creating %s: %w", dst, err)
+	}
+	defer out.Close()
+	fmt.Printf("copying %s to %s\n", src, dst)
+	if _, err := io.Copy(out, in); err != nil {
+		return fmt.Errorf("error copying %s to %s: %w", src, dst, err)
+	}
+	return out.Close()
+}
@@ -0,0 +1,57 @@
+package config
+
+import (
+	"context"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/danielmmetz/settle/internal/brew"
+)
+
+var update = flag.Bool("update", false, "update the golden configs in testdata")
+
+func TestScaffold(t *testing.T) {
+	if _, ok := brew.Path(); ok {
+		t.Skip("brew is installed, so its packages would be scaffolded too")
+	}
+	home, dir, bin := t.TempDir(), t.TempDir(), t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("PATH", bin)
+	write := func(path, contents string, perm os.FileMode) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(contents), perm); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(filepath.Join(bin, "pacman"), "#!/bin/sh\nprintf 'fd\\nripgrep\\n'\n", 0o755)
+	write(filepath.Join(home, ".zshrc"), `source ~/.zprofile
+HISTSIZE=1000
+export PATH=~/bin:$PATH
+alias g=git
+`, 0o644)
+	write(filepath.Join(home, ".gitconfig"), "[user]\n\tname = settle\n", 0o644)
+
+	c, err := Scaffold(context.Background(), dir, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(c.YAML())
+	golden := filepath.Join("testdata", "init.yaml")
+	if *update {
+		if err := os.WriteFile(golden, []byte(got), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != string(want) {
+		t.Fatalf("got:\n%s\nwant:\n%s", got, want)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "gitconfig")); err != nil {
+		t.Fatalf("expected .gitconfig to be copied alongside the config: %v", err)
+	}
+}
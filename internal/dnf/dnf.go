@@ -0,0 +1,324 @@
+package dnf
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/danielmmetz/settle/internal/pkgmgr"
+	"github.com/danielmmetz/settle/internal/plan"
+	"github.com/danielmmetz/settle/internal/privilege"
+	"github.com/danielmmetz/settle/internal/stream"
+	"github.com/danielmmetz/settle/internal/sysfile"
+)
+
+// managedHeader begins each file settle writes to reposDir, by which it recognizes those it owns.
+const managedHeader = "# Managed by settle. Changes will be overwritten.\n"
+
+var reposDir = "/etc/yum.repos.d"
+
+type Dnf struct {
+	// Repos are written as .repo files under /etc/yum.repos.d.
+	Repos []Repo `json:"repos,omitempty"`
+	// Copr lists COPR repositories to enable, e.g. atim/lazygit.
+	Copr   []string `json:"copr,omitempty"`
+	Groups []string `json:"groups,omitempty"`
+	Pkgs   []string `json:"pkgs"`
+	// Prune opts in to removing user-installed packages that aren't declared in Pkgs.
+	Prune *pkgmgr.Prune `json:"prune,omitempty"`
+}
+
+// Repo is an additional repository.
+type Repo struct {
+	// ID identifies the repository, and is used to name its .repo file.
+	ID      string `json:"id"`
+	Name    string `json:"name,omitempty"`
+	BaseURL string `json:"baseurl"`
+	// GPGKey is the URL of the repository's signing key, against which signatures are checked.
+	// It's required unless GPGCheck is explicitly false.
+	GPGKey string `json:"gpgkey,omitempty"`
+	// GPGCheck may be set to false to install from the repository without checking signatures.
+	GPGCheck *bool `json:"gpgcheck,omitempty"`
+}
+
+// checked reports whether signatures are checked for packages from the repository.
+func (r Repo) checked() bool {
+	return r.GPGCheck == nil || *r.GPGCheck
+}
+
+func (r Repo) String() string {
+	name := r.Name
+	if name == "" {
+		name = r.ID
+	}
+	lines := []string{
+		"[" + r.ID + "]",
+		"name=" + name,
+		"baseurl=" + r.BaseURL,
+		"enabled=1",
+	}
+	if r.checked() {
+		lines = append(lines, "gpgcheck=1")
+	} else {
+		lines = append(lines, "gpgcheck=0")
+	}
+	if r.GPGKey != "" {
+		lines = append(lines, "gpgkey="+r.GPGKey)
+	}
+	return managedHeader + strings.Join(lines, "\n") + "\n"
+}
+
+func (d *Dnf) UnmarshalJSON(b []byte) error {
+	if pkgs, ok := pkgmgr.BareList[string](b); ok {
+		*d = Dnf{Pkgs: pkgs}
+		return nil
+	}
+	type dnf Dnf
+	var intermediary dnf
+	if err := json.Unmarshal(b, &intermediary); err != nil {
+		return err
+	}
+	for i, r := range intermediary.Repos {
+		if r.ID == "" || r.BaseURL == "" {
+			return fmt.Errorf("repository %d: id and baseurl are required", i)
+		}
+		if r.GPGKey == "" && r.checked() {
+			return fmt.Errorf("repository %s: gpgkey is required unless signature checks are disabled with gpgcheck: false", r.ID)
+		}
+	}
+	*d = Dnf(intermediary)
+	return nil
+}
+
+func (d *Dnf) Ensure(ctx context.Context) error {
+	if d == nil {
+		return nil
+	}
+
+	if err := d.ensureRepos(ctx); err != nil {
+		return err
+	}
+	if err := d.ensureCopr(ctx); err != nil {
+		return err
+	}
+	if err := d.ensureGroups(ctx); err != nil {
+		return err
+	}
+
+	installed, err := pkgmgr.Dnf{}.Installed(ctx)
+	if err != nil {
+		return err
+	}
+	var missing []string
+	for _, pkg := range d.Pkgs {
+		if _, ok := installed[pkg]; !ok {
+			missing = append(missing, pkg)
+		}
+	}
+	if err := d.install(ctx, missing); err != nil {
+		return err
+	}
+	if d.Prune == nil {
+		return nil
+	}
+	return d.prune(ctx)
+}
+
+func (d *Dnf) install(ctx context.Context, missing []string) error {
+	if len(missing) == 0 {
+		fmt.Printf("all %d dnf packages already present\n", len(d.Pkgs))
+		return nil
+	}
+	if plan.Enabled(ctx) {
+		fmt.Printf("would install %d missing dnf packages: %s\n", len(missing), strings.Join(missing, " "))
+		return nil
+	}
+
+	fmt.Printf("installing %d missing packages with `dnf install`: %s\n", len(missing), strings.Join(missing, " "))
+	if err := (pkgmgr.Dnf{}).Install(ctx, missing); err != nil {
+		return err
+	}
+	fmt.Printf("installed %d dnf packages, %d already present\n", len(missing), len(d.Pkgs)-len(missing))
+	return nil
+}
+
+// ensureRepos writes a .repo file for each declared repository, and removes those settle wrote for repositories no longer declared.
+func (d *Dnf) ensureRepos(ctx context.Context) error {
+	if err := d.removeStaleRepos(ctx); err != nil {
+		return err
+	}
+	for _, r := range d.Repos {
+		if _, err := sysfile.WriteFile(ctx, filepath.Join(reposDir, r.ID+".repo"), []byte(r.String())); err != nil {
+			return fmt.Errorf("error writing repository %s: %w", r.ID, err)
+		}
+	}
+	return nil
+}
+
+// removeStaleRepos removes the .repo files settle wrote for repositories that are no longer declared.
+// Files settle didn't write, as recognized by the absence of managedHeader, are left alone.
+func (d *Dnf) removeStaleRepos(ctx context.Context) error {
+	declared := make(map[string]bool)
+	for _, r := range d.Repos {
+		declared[r.ID+".repo"] = true
+	}
+	entries, err := os.ReadDir(reposDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("error reading %s: %w", reposDir, err)
+	}
+	for _, e := range entries {
+		if declared[e.Name()] || !strings.HasSuffix(e.Name(), ".repo") {
+			continue
+		}
+		path := filepath.Join(reposDir, e.Name())
+		contents, err := os.ReadFile(path)
+		if err != nil || !bytes.HasPrefix(contents, []byte(managedHeader)) {
+			continue
+		}
+		if _, err := sysfile.Remove(ctx, path); err != nil {
+			return fmt.Errorf("error removing repository %s: %w", strings.TrimSuffix(e.Name(), ".repo"), err)
+		}
+	}
+	return nil
+}
+
+// ensureCopr enables each COPR repository that isn't already enabled.
+func (d *Dnf) ensureCopr(ctx context.Context) error {
+	if len(d.Copr) == 0 {
+		return nil
+	}
+	output, err := exec.CommandContext(ctx, "dnf", "copr", "list", "--enabled").Output()
+	if err != nil {
+		return fmt.Errorf("error running `dnf copr list`: %w", err)
+	}
+	enabled := make(map[string]bool)
+	for _, line := range strings.Fields(string(output)) {
+		// entries are listed as hub/owner/project
+		if parts := strings.SplitN(line, "/", 2); len(parts) == 2 {
+			enabled[parts[1]] = true
+		}
+	}
+
+	for _, repo := range d.Copr {
+		if enabled[repo] {
+			continue
+		}
+		if plan.Enabled(ctx) {
+			fmt.Println("would enable COPR repository", repo)
+			continue
+		}
+		fmt.Println("enabling COPR repository", repo)
+		enableCmd := privilege.Command(ctx, "dnf", "copr", "enable", "-y", repo)
+		if output, err := stream.Run(ctx, enableCmd); err != nil {
+			return fmt.Errorf("error running `dnf copr enable %s`: %w\n%s", repo, err, string(output))
+		}
+	}
+	return nil
+}
+
+// ensureGroups installs each group that isn't already installed.
+func (d *Dnf) ensureGroups(ctx context.Context) error {
+	if len(d.Groups) == 0 {
+		return nil
+	}
+	// dnf4 lists ids alongside names only when asked to, whereas dnf5 always does and rejects --ids
+	output, err := exec.CommandContext(ctx, "dnf", "group", "list", "--installed", "--ids").Output()
+	if err != nil {
+		output, err = exec.CommandContext(ctx, "dnf", "group", "list", "--installed").Output()
+	}
+	if err != nil {
+		return fmt.Errorf("error running `dnf group list`: %w", err)
+	}
+	installed := parseGroups(string(output))
+
+	var missing []string
+	for _, group := range d.Groups {
+		if !installed[strings.ToLower(group)] {
+			missing = append(missing, group)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	if plan.Enabled(ctx) {
+		fmt.Printf("would install dnf groups: %s\n", strings.Join(missing, ", "))
+		return nil
+	}
+	fmt.Printf("installing groups with `dnf group install`: %s\n", strings.Join(missing, ", "))
+	installCmd := privilege.Command(ctx, "dnf", append([]string{"group", "install", "-y"}, missing...)...)
+	if output, err := stream.Run(ctx, installCmd); err != nil {
+		return fmt.Errorf("error running `dnf group install`: %w\n%s", err, string(output))
+	}
+	return nil
+}
+
+// parseGroups returns the lowercased ids and names of the groups listed by `dnf group list`,
+// which dnf4 lists as "Name (id)" beneath section headers and dnf5 lists as a table of id, name, and whether it's installed.
+func parseGroups(output string) map[string]bool {
+	groups := make(map[string]bool)
+	table := false
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 0, strings.HasSuffix(line, ":"), strings.HasPrefix(line, "Last metadata expiration check"):
+			continue
+		case fields[0] == "ID" && len(fields) > 1 && fields[1] == "Name":
+			table = true
+			continue
+		}
+		if table {
+			// ids never contain spaces, whereas names may
+			name := fields[1:]
+			if n := len(name); n > 0 && (name[n-1] == "yes" || name[n-1] == "no") {
+				name = name[:n-1]
+			}
+			groups[strings.ToLower(fields[0])] = true
+			groups[strings.ToLower(strings.Join(name, " "))] = true
+			continue
+		}
+		if i := strings.LastIndex(line, " ("); i >= 0 && strings.HasSuffix(line, ")") {
+			groups[strings.ToLower(line[i+2:len(line)-1])] = true
+			line = line[:i]
+		}
+		groups[strings.ToLower(line)] = true
+	}
+	return groups
+}
+
+// prune removes user-installed packages that are neither declared, allowed, nor protected.
+func (d *Dnf) prune(ctx context.Context) error {
+	userInstalled, err := pkgmgr.Dnf{}.UserInstalled(ctx)
+	if err != nil {
+		return err
+	}
+	undeclared := d.Prune.Undeclared(pkgmgr.Dnf{}, userInstalled, d.Pkgs)
+	if len(undeclared) == 0 {
+		fmt.Println("no undeclared dnf packages to prune")
+		return nil
+	}
+
+	if plan.Enabled(ctx) {
+		fmt.Printf("would prune %d undeclared dnf packages: %s\n", len(undeclared), strings.Join(undeclared, " "))
+		return nil
+	}
+	fmt.Printf("pruning %d undeclared packages with `dnf remove`: %s\n", len(undeclared), strings.Join(undeclared, " "))
+	return pkgmgr.Dnf{}.Remove(ctx, undeclared)
+}
+
+// Current returns the packages installed at the user's request.
+func Current(ctx context.Context) (*Dnf, error) {
+	names, err := pkgmgr.Dnf{}.UserInstalled(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &Dnf{Pkgs: names}, nil
+}
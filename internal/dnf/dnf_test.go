@@ -0,0 +1,147 @@
+package dnf
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestParseGroups(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   []string
+	}{
+		{
+			name: "dnf4",
+			output: `Last metadata expiration check: 0:12:03 ago on Sun 18 Oct 2026 10:00:00 AM UTC.
+Installed Environment Groups:
+   Fedora Workstation (workstation-product-environment)
+Installed Groups:
+   Development Tools (development-tools)
+   C Development Tools and Libraries (c-development)
+`,
+			want: []string{
+				"fedora workstation", "workstation-product-environment",
+				"development tools", "development-tools",
+				"c development tools and libraries", "c-development",
+			},
+		},
+		{
+			name: "dnf4 without ids",
+			output: `Installed Groups:
+   Development Tools
+`,
+			want: []string{"development tools"},
+		},
+		{
+			name: "dnf5",
+			output: `ID                   Name              Installed
+development-tools    Development Tools       yes
+c-development        C Development Tools and Libraries yes
+`,
+			want: []string{
+				"development-tools", "development tools",
+				"c-development", "c development tools and libraries",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := make(map[string]bool)
+			for _, g := range tt.want {
+				want[g] = true
+			}
+			if got := parseGroups(tt.output); !reflect.DeepEqual(got, want) {
+				t.Fatalf("got %v, want %v", got, want)
+			}
+		})
+	}
+
+	// groups are matched exactly, rather than by substring
+	if installed := parseGroups(tests[0].output); installed["tools"] || installed["development"] {
+		t.Fatalf("expected no partial matches, got %v", installed)
+	}
+}
+
+func TestRepo(t *testing.T) {
+	tests := []struct {
+		name    string
+		json    string
+		want    string
+		wantErr string
+	}{
+		{
+			name: "signed",
+			json: `{"id": "vscode", "baseurl": "https://example.com/yum", "gpgkey": "https://example.com/key.asc"}`,
+			want: "gpgcheck=1\ngpgkey=https://example.com/key.asc\n",
+		},
+		{
+			name: "explicitly unsigned",
+			json: `{"id": "local", "baseurl": "file:///srv/repo", "gpgcheck": false}`,
+			want: "gpgcheck=0\n",
+		},
+		{
+			name:    "missing gpgkey",
+			json:    `{"id": "local", "baseurl": "file:///srv/repo"}`,
+			wantErr: "gpgkey is required",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var d Dnf
+			err := json.Unmarshal([]byte(`{"repos": [`+tt.json+`], "pkgs": []}`), &d)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := d.Repos[0].String(); !strings.HasSuffix(got, "enabled=1\n"+tt.want) {
+				t.Fatalf("expected repo file ending in %q, got:\n%s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestRemoveStaleRepos(t *testing.T) {
+	defer func(r string) { reposDir = r }(reposDir)
+	reposDir = t.TempDir()
+	for name, contents := range map[string]string{
+		"vscode.repo":  managedHeader + "[vscode]\n",
+		"old.repo":     managedHeader + "[old]\n",
+		"fedora.repo":  "[fedora]\n",
+		"vendor.conf":  managedHeader,
+		"docker.repo~": managedHeader,
+	} {
+		if err := os.WriteFile(filepath.Join(reposDir, name), []byte(contents), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	d := &Dnf{Repos: []Repo{{ID: "vscode"}}}
+	if err := d.removeStaleRepos(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	entries, err := os.ReadDir(reposDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, e := range entries {
+		got = append(got, e.Name())
+	}
+	sort.Strings(got)
+	want := []string{"docker.repo~", "fedora.repo", "vendor.conf", "vscode.repo"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,415 @@
+// Package edit makes targeted edits to YAML config files.
+//
+// Rather than round-tripping through a marshaler, edits are applied as line-level patches
+// to the original source, guided by the positions of the parsed nodes.
+// Comments, blank lines, ordering, and quoting outside of the edited lines are left untouched.
+package edit
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/danielmmetz/settle/internal/atomicfile"
+	"gopkg.in/yaml.v3"
+)
+
+// Document is a YAML file opened for editing.
+type Document struct {
+	path  string
+	lines []string
+}
+
+// Open reads the YAML file at path for editing.
+func Open(path string) (*Document, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", path, err)
+	}
+	d := Document{path: path, lines: strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")}
+	if _, err := d.root(); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// Path returns the path of the underlying file.
+func (d *Document) Path() string { return d.path }
+
+// Bytes returns the current contents of the document.
+func (d *Document) Bytes() []byte {
+	return []byte(strings.Join(d.lines, "\n") + "\n")
+}
+
+// Save writes the document back to its file.
+func (d *Document) Save() error {
+	info, err := os.Stat(d.path)
+	if err != nil {
+		return fmt.Errorf("error reading file info for %s: %w", d.path, err)
+	}
+	if err := atomicfile.WriteFile(d.path, d.Bytes(), info.Mode().Perm()); err != nil {
+		return fmt.Errorf("error writing %s: %w", d.path, err)
+	}
+	return nil
+}
+
+// Append adds item to the end of the sequence found by following keys from the top-level mapping.
+// Missing keys are created, as is the sequence itself.
+// If the existing entries are written in flow style, e.g. {name: a, value: b}, so is item.
+func (d *Document) Append(keys []string, item *yaml.Node) error {
+	root, err := d.root()
+	if err != nil {
+		return err
+	}
+	parent, indent := root, 0
+	for i, key := range keys {
+		keyNode, value := lookup(parent, key)
+		if keyNode == nil {
+			return d.insertKeys(parent, indent, func(indent int) []string { return nest(indent, keys[i:], item) })
+		}
+		if isNull(value) {
+			d.lines[keyNode.Line-1] = strings.Repeat(" ", keyNode.Column-1) + key + ":"
+			return d.insertLines(keyNode.Line, nest(keyNode.Column+1, keys[i+1:], item))
+		}
+		indent = keyNode.Column + 1
+		if i < len(keys)-1 {
+			if value.Kind != yaml.MappingNode {
+				return fmt.Errorf("%s: expected a mapping at %s", d.path, strings.Join(keys[:i+1], "."))
+			}
+			if value.Style&yaml.FlowStyle != 0 {
+				return fmt.Errorf("%s: editing flow-style mapping at %s is not supported", d.path, strings.Join(keys[:i+1], "."))
+			}
+			parent = value
+			continue
+		}
+
+		if value.Kind != yaml.SequenceNode {
+			return fmt.Errorf("%s: expected a list at %s", d.path, strings.Join(keys, "."))
+		}
+		if value.Style&yaml.FlowStyle != 0 {
+			return fmt.Errorf("%s: editing flow-style list at %s is not supported", d.path, strings.Join(keys, "."))
+		}
+		last := value.Content[len(value.Content)-1]
+		if last.Style&yaml.FlowStyle != 0 {
+			item.Style |= yaml.FlowStyle
+		}
+		dash := d.dashColumn(last)
+		return d.insertLines(d.endLine(root, value, dash), entry(dash, item))
+	}
+	return fmt.Errorf("%s: no keys specified", d.path)
+}
+
+// Put sets the key found by following keys from the top-level mapping to value. The key must not already be set.
+// Missing parent keys are created.
+func (d *Document) Put(keys []string, value *yaml.Node) error {
+	root, err := d.root()
+	if err != nil {
+		return err
+	}
+	parent, indent := root, 0
+	for i, key := range keys {
+		keyNode, existing := lookup(parent, key)
+		if keyNode == nil {
+			return d.insertKeys(parent, indent, func(indent int) []string { return field(indent, keys[i:], value) })
+		}
+		if i == len(keys)-1 {
+			return fmt.Errorf("%s: %s is already set", d.path, strings.Join(keys, "."))
+		}
+		if isNull(existing) {
+			d.lines[keyNode.Line-1] = strings.Repeat(" ", keyNode.Column-1) + key + ":"
+			return d.insertLines(keyNode.Line, field(keyNode.Column+1, keys[i+1:], value))
+		}
+		if existing.Kind != yaml.MappingNode {
+			return fmt.Errorf("%s: expected a mapping at %s", d.path, strings.Join(keys[:i+1], "."))
+		}
+		if existing.Style&yaml.FlowStyle != 0 {
+			return fmt.Errorf("%s: editing flow-style mapping at %s is not supported", d.path, strings.Join(keys[:i+1], "."))
+		}
+		parent, indent = existing, keyNode.Column+1
+	}
+	return fmt.Errorf("%s: no keys specified", d.path)
+}
+
+// Remove deletes the entries of the sequence found by following keys for which match returns true.
+// It returns the number of entries removed.
+func (d *Document) Remove(keys []string, match func(*yaml.Node) bool) (int, error) {
+	root, err := d.root()
+	if err != nil {
+		return 0, err
+	}
+	value := root
+	for _, key := range keys {
+		if value.Kind != yaml.MappingNode {
+			return 0, nil
+		}
+		_, value = lookup(value, key)
+		if value == nil {
+			return 0, nil
+		}
+	}
+	if value.Kind != yaml.SequenceNode {
+		return 0, fmt.Errorf("%s: expected a list at %s", d.path, strings.Join(keys, "."))
+	}
+	if value.Style&yaml.FlowStyle != 0 {
+		return 0, fmt.Errorf("%s: editing flow-style list at %s is not supported", d.path, strings.Join(keys, "."))
+	}
+
+	type span struct{ start, end int }
+	var spans []span
+	for _, item := range value.Content {
+		if match(item) {
+			dash := d.dashColumn(item)
+			spans = append(spans, span{start: item.Line, end: d.endLine(root, item, dash)})
+		}
+	}
+	// delete from the bottom up so that earlier line numbers remain valid
+	for i := len(spans) - 1; i >= 0; i-- {
+		d.lines = append(d.lines[:spans[i].start-1], d.lines[spans[i].end:]...)
+	}
+	return len(spans), nil
+}
+
+// Contains reports whether the sequence found by following keys has an entry for which match returns true.
+func (d *Document) Contains(keys []string, match func(*yaml.Node) bool) bool {
+	root, err := d.root()
+	if err != nil {
+		return false
+	}
+	value := root
+	for _, key := range keys {
+		if value.Kind != yaml.MappingNode {
+			return false
+		}
+		if _, value = lookup(value, key); value == nil {
+			return false
+		}
+	}
+	for _, item := range value.Content {
+		if match(item) {
+			return true
+		}
+	}
+	return false
+}
+
+// Kind returns the kind of the node found by following keys, or 0 if there is none.
+func (d *Document) Kind(keys []string) yaml.Kind {
+	root, err := d.root()
+	if err != nil {
+		return 0
+	}
+	value := root
+	for _, key := range keys {
+		if value.Kind != yaml.MappingNode {
+			return 0
+		}
+		if _, value = lookup(value, key); value == nil {
+			return 0
+		}
+	}
+	return value.Kind
+}
+
+// Has reports whether the top-level mapping contains key.
+func (d *Document) Has(key string) bool {
+	root, err := d.root()
+	if err != nil {
+		return false
+	}
+	keyNode, _ := lookup(root, key)
+	return keyNode != nil
+}
+
+// root parses the current contents of d, returning its top-level mapping.
+// It is re-parsed on each edit so that node positions always reflect the current lines.
+func (d *Document) root() (*yaml.Node, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(d.Bytes(), &doc); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %w", d.path, err)
+	}
+	if len(doc.Content) == 0 {
+		return &yaml.Node{Kind: yaml.MappingNode}, nil
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("%s: expected a mapping at the top level", d.path)
+	}
+	if root.Style&yaml.FlowStyle != 0 {
+		return nil, fmt.Errorf("%s: editing a flow-style document is not supported", d.path)
+	}
+	return root, nil
+}
+
+// insertKeys adds the lines produced by render, given the indentation of mapping's keys, to the end of mapping.
+func (d *Document) insertKeys(mapping *yaml.Node, indent int, render func(indent int) []string) error {
+	if len(mapping.Content) > 0 {
+		indent = mapping.Content[0].Column - 1
+	}
+	at := len(d.lines)
+	if len(mapping.Content) > 0 {
+		root, err := d.root()
+		if err != nil {
+			return err
+		}
+		at = d.endLine(root, mapping, indent)
+	}
+	// trim trailing blank lines when appending to the end of the document
+	for at == len(d.lines) && at > 0 && strings.TrimSpace(d.lines[at-1]) == "" {
+		d.lines = d.lines[:at-1]
+		at--
+	}
+	return d.insertLines(at, render(indent))
+}
+
+// insertLines inserts lines after the given 1-indexed line.
+func (d *Document) insertLines(after int, lines []string) error {
+	updated := make([]string, 0, len(d.lines)+len(lines))
+	updated = append(updated, d.lines[:after]...)
+	updated = append(updated, lines...)
+	updated = append(updated, d.lines[after:]...)
+	previous := d.lines
+	d.lines = updated
+	if _, err := d.root(); err != nil {
+		d.lines = previous
+		return fmt.Errorf("edit would produce invalid YAML: %w", err)
+	}
+	return nil
+}
+
+// dashColumn returns the 0-indexed column of the "-" introducing the sequence entry item.
+func (d *Document) dashColumn(item *yaml.Node) int {
+	line := d.lines[item.Line-1]
+	for col := min(item.Column-1, len(line)-1); col >= 0; col-- {
+		if line[col] == '-' {
+			return col
+		}
+	}
+	return max(item.Column-3, 0)
+}
+
+// endLine returns the last 1-indexed line occupied by node.
+// Trailing blank lines and comments at or left of indent are considered to belong to whatever follows.
+func (d *Document) endLine(root, node *yaml.Node, indent int) int {
+	last := maxLine(node)
+	end := len(d.lines)
+	walk(root, func(n *yaml.Node) {
+		if n.Line > last && n.Line-1 < end {
+			end = n.Line - 1
+		}
+	})
+	for end > last {
+		trimmed := strings.TrimSpace(d.lines[end-1])
+		leading := len(d.lines[end-1]) - len(strings.TrimLeft(d.lines[end-1], " "))
+		if trimmed != "" && !(strings.HasPrefix(trimmed, "#") && leading <= indent) {
+			break
+		}
+		end--
+	}
+	return end
+}
+
+func lookup(mapping *yaml.Node, key string) (*yaml.Node, *yaml.Node) {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i], mapping.Content[i+1]
+		}
+	}
+	return nil, nil
+}
+
+func isNull(n *yaml.Node) bool {
+	return n.Kind == yaml.ScalarNode && n.Tag == "!!null"
+}
+
+func maxLine(n *yaml.Node) int {
+	line := n.Line
+	walk(n, func(c *yaml.Node) { line = max(line, c.Line) })
+	return line
+}
+
+func walk(n *yaml.Node, f func(*yaml.Node)) {
+	f(n)
+	for _, c := range n.Content {
+		walk(c, f)
+	}
+}
+
+// nest renders keys as nested mappings starting at indent, ending in a sequence containing item.
+func nest(indent int, keys []string, item *yaml.Node) []string {
+	var lines []string
+	for _, key := range keys {
+		lines = append(lines, strings.Repeat(" ", indent)+key+":")
+		indent += 2
+	}
+	return append(lines, entry(indent, item)...)
+}
+
+// field renders keys as nested mappings starting at indent, the last of which is set to value.
+func field(indent int, keys []string, value *yaml.Node) []string {
+	var lines []string
+	for _, key := range keys[:len(keys)-1] {
+		lines = append(lines, strings.Repeat(" ", indent)+key+":")
+		indent += 2
+	}
+	rendered := encode(value)
+	key := strings.Repeat(" ", indent) + keys[len(keys)-1] + ":"
+	if value.Kind == yaml.ScalarNode || value.Style&yaml.FlowStyle != 0 {
+		return append(lines, key+" "+rendered[0])
+	}
+	lines = append(lines, key)
+	for _, l := range rendered {
+		lines = append(lines, strings.Repeat(" ", indent+2)+l)
+	}
+	return lines
+}
+
+func encode(n *yaml.Node) []string {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	_ = enc.Encode(n)
+	return strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+}
+
+// entry renders item as a sequence entry whose "-" is at column indent.
+func entry(indent int, item *yaml.Node) []string {
+	rendered := encode(item)
+	lines := make([]string, len(rendered))
+	for i, l := range rendered {
+		prefix := strings.Repeat(" ", indent) + "  "
+		if i == 0 {
+			prefix = strings.Repeat(" ", indent) + "- "
+		}
+		lines[i] = prefix + l
+	}
+	return lines
+}
+
+// Name returns the identifying value of a sequence entry:
+// the entry itself if it is a scalar, or the value of its name key if it is a mapping.
+func Name(n *yaml.Node) string {
+	switch n.Kind {
+	case yaml.ScalarNode:
+		return n.Value
+	case yaml.MappingNode:
+		if _, value := lookup(n, "name"); value != nil {
+			return value.Value
+		}
+	}
+	return ""
+}
+
+// Scalar returns a node for the string value s.
+func Scalar(s string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: s}
+}
+
+// Map returns a mapping node of the given alternating keys and values, in order.
+func Map(kvs ...string) *yaml.Node {
+	n := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	for _, s := range kvs {
+		n.Content = append(n.Content, Scalar(s))
+	}
+	return n
+}
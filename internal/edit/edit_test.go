@@ -0,0 +1,427 @@
+package edit
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func open(t *testing.T, contents string) *Document {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "settle.yaml")
+	if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	d, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func TestAppend(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		keys    []string
+		item    *yaml.Node
+		want    string
+		wantErr string
+	}{
+		{
+			name: "block list",
+			input: `# packages to install
+brew:
+  pkgs:
+    - ripgrep  # search
+    - fd
+
+  # casks go here
+files: []
+`,
+			keys: []string{"brew", "pkgs"},
+			item: Scalar("jq"),
+			want: `# packages to install
+brew:
+  pkgs:
+    - ripgrep  # search
+    - fd
+    - jq
+
+  # casks go here
+files: []
+`,
+		},
+		{
+			name: "unindented block list",
+			input: `brew:
+  pkgs:
+  - ripgrep
+`,
+			keys: []string{"brew", "pkgs"},
+			item: Scalar("jq"),
+			want: `brew:
+  pkgs:
+  - ripgrep
+  - jq
+`,
+		},
+		{
+			name: "mapping entries",
+			input: `files:
+  - src: a
+    dst: ~/a
+`,
+			keys: []string{"files"},
+			item: Map("src", "b", "dst", "~/b"),
+			want: `files:
+  - src: a
+    dst: ~/a
+  - src: b
+    dst: ~/b
+`,
+		},
+		{
+			name: "flow-style entries",
+			input: `zsh:
+  variables:
+    - {name: EDITOR, value: nvim}
+`,
+			keys: []string{"zsh", "variables"},
+			item: Map("name", "PAGER", "value", "less"),
+			want: `zsh:
+  variables:
+    - {name: EDITOR, value: nvim}
+    - {name: PAGER, value: less}
+`,
+		},
+		{
+			name: "null key",
+			input: `brew:
+  pkgs: # none yet
+  casks:
+    - iterm2
+`,
+			keys: []string{"brew", "pkgs"},
+			item: Scalar("jq"),
+			want: `brew:
+  pkgs:
+    - jq
+  casks:
+    - iterm2
+`,
+		},
+		{
+			name: "missing key",
+			input: `brew:
+  casks:
+    - iterm2
+
+`,
+			keys: []string{"brew", "pkgs"},
+			item: Scalar("jq"),
+			want: `brew:
+  casks:
+    - iterm2
+  pkgs:
+    - jq
+
+`,
+		},
+		{
+			name:  "missing parent",
+			input: "files: []\n",
+			keys:  []string{"brew", "pkgs"},
+			item:  Scalar("jq"),
+			want: `files: []
+brew:
+  pkgs:
+    - jq
+`,
+		},
+		{
+			name:    "flow sequence",
+			input:   "brew:\n  pkgs: [ripgrep, fd]\n",
+			keys:    []string{"brew", "pkgs"},
+			item:    Scalar("jq"),
+			wantErr: "flow-style list",
+		},
+		{
+			name:    "not a list",
+			input:   "brew:\n  pkgs: ripgrep\n",
+			keys:    []string{"brew", "pkgs"},
+			item:    Scalar("jq"),
+			wantErr: "expected a list",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := open(t, tt.input)
+			err := d.Append(tt.keys, tt.item)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want one containing %q", err, tt.wantErr)
+				}
+				if got := string(d.Bytes()); got != tt.input {
+					t.Errorf("document changed on error:\n%s", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := string(d.Bytes()); got != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRemove(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		keys    []string
+		remove  string
+		want    string
+		wantN   int
+		wantErr string
+	}{
+		{
+			name: "trailing comments",
+			input: `brew:
+  pkgs:
+    - ripgrep  # search
+    - fd       # find
+    - jq
+  # casks go here
+  casks: []
+`,
+			keys:   []string{"brew", "pkgs"},
+			remove: "fd",
+			want: `brew:
+  pkgs:
+    - ripgrep  # search
+    - jq
+  # casks go here
+  casks: []
+`,
+			wantN: 1,
+		},
+		{
+			name: "last entry keeps following comment",
+			input: `brew:
+  pkgs:
+    - ripgrep
+    - fd  # find
+# taps
+taps: []
+`,
+			keys:   []string{"brew", "pkgs"},
+			remove: "fd",
+			want: `brew:
+  pkgs:
+    - ripgrep
+# taps
+taps: []
+`,
+			wantN: 1,
+		},
+		{
+			name: "mapping entries by name",
+			input: `zsh:
+  variables:
+    - name: EDITOR  # preferred
+      value: nvim
+    - name: PAGER
+      value: less
+`,
+			keys:   []string{"zsh", "variables"},
+			remove: "EDITOR",
+			want: `zsh:
+  variables:
+    - name: PAGER
+      value: less
+`,
+			wantN: 1,
+		},
+		{
+			name:   "no match",
+			input:  "brew:\n  pkgs:\n    - ripgrep\n",
+			keys:   []string{"brew", "pkgs"},
+			remove: "fd",
+			want:   "brew:\n  pkgs:\n    - ripgrep\n",
+		},
+		{
+			name:   "missing key",
+			input:  "files: []\n",
+			keys:   []string{"brew", "pkgs"},
+			remove: "fd",
+			want:   "files: []\n",
+		},
+		{
+			name:    "flow sequence",
+			input:   "brew:\n  pkgs: [ripgrep, fd]\n",
+			keys:    []string{"brew", "pkgs"},
+			remove:  "fd",
+			wantErr: "flow-style list",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := open(t, tt.input)
+			n, err := d.Remove(tt.keys, func(n *yaml.Node) bool { return Name(n) == tt.remove })
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != tt.wantN {
+				t.Errorf("removed %d entries, want %d", n, tt.wantN)
+			}
+			if got := string(d.Bytes()); got != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPut(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		keys    []string
+		value   *yaml.Node
+		want    string
+		wantErr string
+	}{
+		{
+			name: "missing key",
+			input: `# managed by settle
+brew:
+  pkgs:
+    - ripgrep  # search
+
+`,
+			keys:  []string{"brew", "cleanup"},
+			value: Scalar("true"),
+			want: `# managed by settle
+brew:
+  pkgs:
+    - ripgrep  # search
+  cleanup: "true"
+
+`,
+		},
+		{
+			name:  "missing parents",
+			input: "files: []\n",
+			keys:  []string{"packages", "prune", "allow"},
+			value: &yaml.Node{Kind: yaml.SequenceNode, Content: []*yaml.Node{Scalar("base")}},
+			want: `files: []
+packages:
+  prune:
+    allow:
+      - base
+`,
+		},
+		{
+			name:  "null parent",
+			input: "packages:\nfiles: []\n",
+			keys:  []string{"packages", "manager"},
+			value: Scalar("pacman"),
+			want:  "packages:\n  manager: pacman\nfiles: []\n",
+		},
+		{
+			name:    "existing key",
+			input:   "packages:\n  manager: apt\n",
+			keys:    []string{"packages", "manager"},
+			value:   Scalar("pacman"),
+			wantErr: "already set",
+		},
+		{
+			name:    "scalar parent",
+			input:   "packages: apt\n",
+			keys:    []string{"packages", "manager"},
+			value:   Scalar("pacman"),
+			wantErr: "expected a mapping",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := open(t, tt.input)
+			err := d.Put(tt.keys, tt.value)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want one containing %q", err, tt.wantErr)
+				}
+				if got := string(d.Bytes()); got != tt.input {
+					t.Errorf("document changed on error:\n%s", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := string(d.Bytes()); got != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInsertLinesRejectsInvalidYAML(t *testing.T) {
+	input := "brew:\n  pkgs:\n    - ripgrep\n"
+	d := open(t, input)
+	err := d.insertLines(3, []string{"  pkgs: [unterminated"})
+	if err == nil || !strings.Contains(err.Error(), "invalid YAML") {
+		t.Fatalf("got error %v, want one about invalid YAML", err)
+	}
+	if got := string(d.Bytes()); got != input {
+		t.Errorf("document changed on error:\n%s", got)
+	}
+}
+
+func TestOwner(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, contents string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(contents), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("settle.yaml", "includes:\n  - base.yaml\n  - hosts/work.yaml\nfiles: []\n")
+	write("base.yaml", "brew:\n  pkgs: [git]\nzsh:\n  aliases: []\n")
+	write("hosts/work.yaml", "brew:\n  casks: [slack]\n")
+
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{key: "files", want: "settle.yaml"},
+		{key: "brew", want: "hosts/work.yaml"},
+		{key: "zsh", want: "base.yaml"},
+		{key: "nvim", want: "settle.yaml"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			d, err := Owner(filepath.Join(dir, "settle.yaml"), tt.key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := filepath.Join(dir, tt.want); d.Path() != want {
+				t.Errorf("got %s, want %s", d.Path(), want)
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package edit
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Owner opens the file that defines the top-level key for the config at configPath.
+// Following the resolution order of includes, that's the config file itself if it defines key,
+// otherwise the last of its includes that does.
+// If no file defines key, the config file itself is returned.
+func Owner(configPath, key string) (*Document, error) {
+	doc, err := Open(configPath)
+	if err != nil {
+		return nil, err
+	}
+	if doc.Has(key) {
+		return doc, nil
+	}
+
+	var includes struct {
+		Includes []string `yaml:"includes"`
+	}
+	if err := yaml.Unmarshal(doc.Bytes(), &includes); err != nil {
+		return nil, fmt.Errorf("error parsing includes of %s: %w", configPath, err)
+	}
+	for i := len(includes.Includes) - 1; i >= 0; i-- {
+		path := includes.Includes[i]
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(filepath.Dir(configPath), path)
+		}
+		include, err := Open(path)
+		if err != nil {
+			return nil, err
+		}
+		if include.Has(key) {
+			return include, nil
+		}
+	}
+	return doc, nil
+}
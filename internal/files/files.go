@@ -8,6 +8,9 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+
+	"github.com/danielmmetz/settle/internal/journal"
+	"github.com/danielmmetz/settle/internal/plan"
 )
 
 type Files []FileMapping
@@ -33,16 +36,21 @@ func (f *Files) Ensure(ctx context.Context) error {
 			if err == nil && resolvedLink == m.Src {
 				continue
 			}
-			fmt.Println("file exists, deleting it:", m.Dst)
-			if err := os.Remove(m.Dst); err != nil {
-				return err
+			if plan.Enabled(ctx) {
+				fmt.Println("would replace existing file:", m.Dst)
+			} else {
+				fmt.Println("file exists, replacing it:", m.Dst)
 			}
 		}
-		if err := os.MkdirAll(filepath.Dir(m.Dst), 0o755); err != nil {
+		if plan.Enabled(ctx) {
+			fmt.Printf("would symlink %s to %s\n", m.Src, m.Dst)
+			continue
+		}
+		if err := journal.MkdirAll(ctx, filepath.Dir(m.Dst), 0o755); err != nil {
 			return fmt.Errorf("error making intermediate directories for %s: %w", m.Dst, err)
 		}
 		fmt.Printf("symlinking %s to %s\n", m.Src, m.Dst)
-		if err := os.Symlink(m.Src, m.Dst); err != nil {
+		if err := journal.Symlink(ctx, m.Src, m.Dst); err != nil {
 			return fmt.Errorf("error writing symlink from %s to %s: %w", m.Src, m.Dst, err)
 		}
 	}
@@ -87,3 +95,86 @@ func expandTilde(path string) (string, error) {
 	}
 	return filepath.Join(components...), nil
 }
+
+// Discover returns mappings for the dotfiles found directly within home.
+// Symlinks map back to their current target. Regular files map from a source named after the dotfile
+// without its leading dot, relative to the config file, as is the convention for dotfiles repositories.
+// Directories and files known to hold machine-local state, such as shell history, are excluded,
+// as are files known to hold credentials, which would otherwise end up in the dotfiles repository.
+func Discover(home string) (Files, error) {
+	entries, err := os.ReadDir(home)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", home, err)
+	}
+	var f Files
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasPrefix(name, ".") || isLocalState(name) {
+			continue
+		}
+		if isCredentials(name) {
+			fmt.Println("skipping dotfile that may hold credentials:", name)
+			continue
+		}
+		dst := filepath.Join("~", name)
+		switch {
+		case e.Type()&os.ModeSymlink != 0:
+			target, err := os.Readlink(filepath.Join(home, name))
+			if err != nil {
+				return nil, fmt.Errorf("error reading symlink %s: %w", name, err)
+			}
+			f = append(f, FileMapping{Src: target, Dst: dst})
+		case e.Type().IsRegular():
+			f = append(f, FileMapping{Src: strings.TrimPrefix(name, "."), Dst: dst})
+		}
+	}
+	return f, nil
+}
+
+// credentials are dotfiles that conventionally hold passwords or tokens.
+var credentials = map[string]bool{
+	".netrc":           true,
+	".authinfo":        true,
+	".authinfo.gpg":    true,
+	".npmrc":           true,
+	".yarnrc":          true,
+	".pypirc":          true,
+	".pgpass":          true,
+	".my.cnf":          true,
+	".git-credentials": true,
+	".gitcookies":      true,
+	".dockercfg":       true,
+	".boto":            true,
+	".s3cfg":           true,
+	".vault-token":     true,
+	".terraformrc":     true,
+	".fetchmailrc":     true,
+	".msmtprc":         true,
+	".env":             true,
+}
+
+func isCredentials(name string) bool {
+	if credentials[name] || strings.HasPrefix(name, ".env.") {
+		return true
+	}
+	lower := strings.ToLower(name)
+	for _, hint := range []string{"credential", "secret", "token", "password", "passwd"} {
+		if strings.Contains(lower, hint) {
+			return true
+		}
+	}
+	for _, ext := range []string{".pem", ".key", ".p12", ".pfx"} {
+		if strings.HasSuffix(lower, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+func isLocalState(name string) bool {
+	switch name {
+	case ".DS_Store", ".CFUserTextEncoding", ".Xauthority", ".ICEauthority", ".lesshst", ".viminfo", ".wget-hsts", ".sudo_as_admin_successful":
+		return true
+	}
+	return strings.Contains(name, "history") || strings.HasPrefix(name, ".zcompdump")
+}
@@ -0,0 +1,38 @@
+package files
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/danielmmetz/settle/internal/journal"
+)
+
+func TestEnsureRestoreRemovesDirectories(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "dotfiles", "gitconfig")
+	if err := os.MkdirAll(filepath.Dir(src), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(src, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	dst := filepath.Join(dir, "home", ".config", "git", "config")
+
+	j := journal.New()
+	f := Files{{Src: src, Dst: dst}}
+	if err := f.Ensure(journal.With(context.Background(), j)); err != nil {
+		t.Fatal(err)
+	}
+	if link, err := os.Readlink(dst); err != nil || link != src {
+		t.Fatalf("expected %s to link to %s, got %q, %v", dst, src, link, err)
+	}
+
+	if _, err := j.Restore(); err != nil {
+		t.Fatalf("unexpected error restoring: %v", err)
+	}
+	if _, err := os.Lstat(filepath.Join(dir, "home")); !os.IsNotExist(err) {
+		t.Fatalf("expected the created directories to be removed, got %v", err)
+	}
+}
@@ -0,0 +1,240 @@
+// Package journal records the prior state of files modified during a run so that they may be restored if the run fails.
+package journal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/danielmmetz/settle/internal/atomicfile"
+)
+
+// Journal is the set of files modified during a single run, along with their state prior to the first modification.
+type Journal struct {
+	entries []entry
+	seen    map[string]bool
+}
+
+type entry struct {
+	path    string
+	existed bool
+	mode    os.FileMode
+	// link is the target of path if it was a symlink.
+	link string
+	data []byte
+	// movedFrom is where path was moved from by Move, if it was.
+	movedFrom string
+}
+
+func New() *Journal {
+	return &Journal{seen: make(map[string]bool)}
+}
+
+type contextKey struct{}
+
+// With returns a copy of ctx carrying j, which is used by WriteFile and Symlink.
+func With(ctx context.Context, j *Journal) context.Context {
+	return context.WithValue(ctx, contextKey{}, j)
+}
+
+func from(ctx context.Context) *Journal {
+	j, _ := ctx.Value(contextKey{}).(*Journal)
+	return j
+}
+
+// WriteFile atomically writes data to path, first recording its prior state in the journal carried by ctx, if any.
+// As with atomicfile.WriteFile, if path is a symlink the file it points to is written instead.
+func WriteFile(ctx context.Context, path string, data []byte, perm os.FileMode) error {
+	if j := from(ctx); j != nil {
+		resolved, err := filepath.EvalSymlinks(path)
+		if err != nil {
+			resolved = path
+		}
+		if err := j.Record(resolved); err != nil {
+			return err
+		}
+	}
+	return atomicfile.WriteFile(path, data, perm)
+}
+
+// Symlink atomically replaces newname with a symlink to oldname,
+// first recording the prior state of newname in the journal carried by ctx, if any.
+func Symlink(ctx context.Context, oldname, newname string) error {
+	if j := from(ctx); j != nil {
+		if err := j.Record(newname); err != nil {
+			return err
+		}
+	}
+	return atomicfile.Symlink(oldname, newname)
+}
+
+// MkdirAll creates path along with any missing parents,
+// recording each directory it creates in the journal carried by ctx, if any, such that Restore removes them.
+func MkdirAll(ctx context.Context, path string, perm os.FileMode) error {
+	if j := from(ctx); j != nil {
+		var missing []string
+		for dir := path; ; dir = filepath.Dir(dir) {
+			if _, err := os.Lstat(dir); err == nil || dir == filepath.Dir(dir) {
+				break
+			}
+			missing = append(missing, dir)
+		}
+		for i := len(missing) - 1; i >= 0; i-- {
+			if err := j.Record(missing[i]); err != nil {
+				return err
+			}
+		}
+	}
+	return os.MkdirAll(path, perm)
+}
+
+// Move moves oldpath, be it a file or a directory, to newpath, which mustn't exist,
+// and records the move in the journal carried by ctx, if any, such that Restore moves it back.
+// If the two are on different filesystems, oldpath is copied and then removed.
+func Move(ctx context.Context, oldpath, newpath string) error {
+	if _, err := os.Lstat(newpath); err == nil {
+		return fmt.Errorf("refusing to move %s to %s: it already exists", oldpath, newpath)
+	}
+	if err := move(oldpath, newpath); err != nil {
+		return err
+	}
+	if j := from(ctx); j != nil {
+		j.entries = append(j.entries, entry{path: newpath, movedFrom: oldpath})
+	}
+	return nil
+}
+
+func move(oldpath, newpath string) error {
+	err := os.Rename(oldpath, newpath)
+	if !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+	if err := copyAll(oldpath, newpath); err != nil {
+		_ = os.RemoveAll(newpath)
+		return fmt.Errorf("error copying %s to %s: %w", oldpath, newpath, err)
+	}
+	return os.RemoveAll(oldpath)
+}
+
+// copyAll copies the file or directory tree at src to dst, preserving permissions and symlinks.
+func copyAll(src, dst string) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case d.IsDir():
+			return os.Mkdir(target, info.Mode().Perm())
+		case d.Type()&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case d.Type().IsRegular():
+			return copyFile(path, target, info.Mode().Perm())
+		default:
+			return fmt.Errorf("unable to copy %s: not a regular file, directory, or symlink", path)
+		}
+	})
+}
+
+func copyFile(src, dst string, perm os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// Record captures the current state of path, unless it has already been recorded.
+func (j *Journal) Record(path string) error {
+	if j.seen[path] {
+		return nil
+	}
+	e := entry{path: path}
+	info, err := os.Lstat(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return fmt.Errorf("error recording prior state of %s: %w", path, err)
+	case info.Mode()&os.ModeSymlink != 0:
+		e.existed = true
+		if e.link, err = os.Readlink(path); err != nil {
+			return fmt.Errorf("error recording prior state of %s: %w", path, err)
+		}
+	case info.Mode().IsRegular():
+		e.existed, e.mode = true, info.Mode().Perm()
+		if e.data, err = os.ReadFile(path); err != nil {
+			return fmt.Errorf("error recording prior state of %s: %w", path, err)
+		}
+	default:
+		return fmt.Errorf("refusing to modify %s: not a regular file or symlink", path)
+	}
+	j.seen[path] = true
+	j.entries = append(j.entries, e)
+	return nil
+}
+
+// Restore returns each recorded file to its prior state, in reverse order of modification.
+// It returns the paths that were restored.
+func (j *Journal) Restore() ([]string, error) {
+	var restored []string
+	var errs []error
+	for i := len(j.entries) - 1; i >= 0; i-- {
+		e := j.entries[i]
+		var err error
+		switch {
+		case e.movedFrom != "":
+			err = move(e.path, e.movedFrom)
+		case !e.existed:
+			err = os.Remove(e.path)
+			if errors.Is(err, os.ErrNotExist) {
+				err = nil
+			}
+		case e.link != "":
+			err = atomicfile.Symlink(e.link, e.path)
+		default:
+			// replace rather than write through whatever now occupies the path
+			if info, lerr := os.Lstat(e.path); lerr == nil && info.Mode()&os.ModeSymlink != 0 {
+				if err = os.Remove(e.path); err != nil {
+					break
+				}
+			}
+			err = atomicfile.WriteFile(e.path, e.data, e.mode)
+		}
+		path := e.path
+		if e.movedFrom != "" {
+			path = e.movedFrom
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("error restoring %s: %w", path, err))
+			continue
+		}
+		restored = append(restored, path)
+	}
+	return restored, errors.Join(errs...)
+}
@@ -0,0 +1,86 @@
+package journal
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMoveRestore(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, ".vimrc")
+	if err := os.WriteFile(target, []byte("set number\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	src := filepath.Join(dir, "dotfiles", "vim", "vimrc")
+
+	j := New()
+	ctx := With(context.Background(), j)
+	if err := MkdirAll(ctx, filepath.Dir(src), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := Move(ctx, target, src); err != nil {
+		t.Fatal(err)
+	}
+	if err := Symlink(ctx, src, target); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := j.Restore(); err != nil {
+		t.Fatalf("unexpected error restoring: %v", err)
+	}
+	info, err := os.Lstat(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.Mode().IsRegular() || info.Mode().Perm() != 0o600 {
+		t.Fatalf("expected %s to be restored as a regular file with mode 0600, got %s", target, info.Mode())
+	}
+	if _, err := os.Lstat(filepath.Join(dir, "dotfiles")); !os.IsNotExist(err) {
+		t.Fatalf("expected the created directories to be removed, got %v", err)
+	}
+}
+
+func TestMoveExisting(t *testing.T) {
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a"), filepath.Join(dir, "b")
+	for _, path := range []string{a, b} {
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := Move(context.Background(), a, b); err == nil {
+		t.Fatal("expected an error moving onto an existing file")
+	}
+}
+
+func TestCopyAll(t *testing.T) {
+	src, dst := filepath.Join(t.TempDir(), "nvim"), filepath.Join(t.TempDir(), "nvim")
+	if err := os.MkdirAll(filepath.Join(src, "lua"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "lua", "init.lua"), []byte("-- init\n"), 0o640); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("lua/init.lua", filepath.Join(src, "init.lua")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := copyAll(src, dst); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(filepath.Join(dst, "init.lua"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "-- init\n" {
+		t.Fatalf("unexpected contents %q", b)
+	}
+	if link, err := os.Readlink(filepath.Join(dst, "init.lua")); err != nil || link != "lua/init.lua" {
+		t.Fatalf("expected symlink to lua/init.lua, got %q (%v)", link, err)
+	}
+	if info, err := os.Stat(filepath.Join(dst, "lua", "init.lua")); err != nil || info.Mode().Perm() != 0o640 {
+		t.Fatalf("expected mode 0640, got %v (%v)", info, err)
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package lock
+
+import "os"
+
+// tryLock is a no-op on platforms without flock: concurrent runs aren't guarded against.
+func tryLock(f *os.File) error { return nil }
+
+func unlock(f *os.File) error { return nil }
@@ -0,0 +1,97 @@
+// Package lock guards against concurrent settle runs by means of an advisory lock file.
+package lock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrLocked is returned when the lock is held by another process.
+var ErrLocked = errors.New("lock is held by another process")
+
+// Lock is a held lock file.
+type Lock struct {
+	f *os.File
+}
+
+// Path returns the default location of the lock file within the settle state directory.
+func Path() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("unable to determine home dir: %w", err)
+	}
+	return filepath.Join(home, ".local", "state", "settle", "settle.lock"), nil
+}
+
+// Acquire takes the lock at path, recording the current process's pid within it.
+// If the lock is held by another settle run, Acquire either fails immediately,
+// or, if wait is true, blocks until the lock is released or ctx is done.
+func Acquire(ctx context.Context, path string, wait bool) (*Lock, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("error making intermediate directories for %s: %w", path, err)
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("error opening lock file %s: %w", path, err)
+	}
+
+	announced := false
+	for {
+		err := tryLock(f)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, ErrLocked) {
+			_ = f.Close()
+			return nil, fmt.Errorf("error locking %s: %w", path, err)
+		}
+		if !wait {
+			_ = f.Close()
+			return nil, fmt.Errorf("another settle run (pid %s) in progress: pass -wait to wait for it to finish", holder(path))
+		}
+		if !announced {
+			fmt.Printf("waiting for another settle run (pid %s) to finish\n", holder(path))
+			announced = true
+		}
+		select {
+		case <-ctx.Done():
+			_ = f.Close()
+			return nil, ctx.Err()
+		case <-time.After(250 * time.Millisecond):
+		}
+	}
+
+	if err := f.Truncate(0); err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("error truncating lock file %s: %w", path, err)
+	}
+	if _, err := f.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0); err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("error writing pid to lock file %s: %w", path, err)
+	}
+	return &Lock{f: f}, nil
+}
+
+// Release releases the lock.
+func (l *Lock) Release() error {
+	if err := unlock(l.f); err != nil {
+		_ = l.f.Close()
+		return fmt.Errorf("error unlocking %s: %w", l.f.Name(), err)
+	}
+	return l.f.Close()
+}
+
+// holder returns the pid recorded in the lock file at path, if known.
+func holder(path string) string {
+	b, err := os.ReadFile(path)
+	if err != nil || strings.TrimSpace(string(b)) == "" {
+		return "unknown"
+	}
+	return strings.TrimSpace(string(b))
+}
@@ -0,0 +1,44 @@
+//go:build unix
+
+package lock
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestAcquire(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "settle.lock")
+	l, err := Acquire(context.Background(), path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = Acquire(context.Background(), path, false)
+	want := "another settle run (pid " + strconv.Itoa(os.Getpid()) + ") in progress"
+	if err == nil || !strings.Contains(err.Error(), want) {
+		t.Fatalf("expected error containing %q while the lock is held, got %v", want, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := Acquire(ctx, path, true); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected waiting to stop once ctx is done, got %v", err)
+	}
+
+	if err := l.Release(); err != nil {
+		t.Fatal(err)
+	}
+	l, err = Acquire(context.Background(), path, false)
+	if err != nil {
+		t.Fatalf("expected the released lock to be acquirable, got %v", err)
+	}
+	if err := l.Release(); err != nil {
+		t.Fatal(err)
+	}
+}
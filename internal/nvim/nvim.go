@@ -8,6 +8,10 @@ import (
 	"os/exec"
 	"path/filepath"
 	"strings"
+
+	"github.com/danielmmetz/settle/internal/journal"
+	"github.com/danielmmetz/settle/internal/plan"
+	"github.com/danielmmetz/settle/internal/stream"
 )
 
 type Nvim struct {
@@ -20,18 +24,22 @@ func (v *Nvim) Ensure(ctx context.Context) error {
 		return nil
 	}
 
-	if err := v.ensureInitVim(); err != nil {
+	if err := v.ensureInitVim(ctx); err != nil {
 		return fmt.Errorf("error ensuring init.lua: %w", err)
 	}
+	if plan.Enabled(ctx) {
+		fmt.Println("would install neovim plugins")
+		return nil
+	}
 	fmt.Println("installing neovim plugins")
 	installCmd := exec.CommandContext(ctx, "nvim", "--headless", "+PaqInstall", "+qa")
-	if output, err := installCmd.CombinedOutput(); err != nil {
+	if output, err := stream.Run(ctx, installCmd); err != nil {
 		return fmt.Errorf("error running neovim plugin sync commands: %w\n%s", err, string(output))
 	}
 	return nil
 }
 
-func (v *Nvim) ensureInitVim() error {
+func (v *Nvim) ensureInitVim(ctx context.Context) error {
 	if len(v.Plugins) == 0 && v.Config == "" {
 		return nil
 	}
@@ -40,11 +48,15 @@ func (v *Nvim) ensureInitVim() error {
 		return fmt.Errorf("unable to determine home dir: %w", err)
 	}
 	cfgPath := filepath.Join(home, ".config", "nvim", "init.lua")
-	if err := os.MkdirAll(filepath.Dir(cfgPath), 0o755); err != nil {
+	if plan.Enabled(ctx) {
+		fmt.Println("would write vim config to", cfgPath)
+		return nil
+	}
+	if err := journal.MkdirAll(ctx, filepath.Dir(cfgPath), 0o755); err != nil {
 		return fmt.Errorf("error making intermediate directories for %s: %w", cfgPath, err)
 	}
 	fmt.Println("writing vim config to", cfgPath)
-	return os.WriteFile(cfgPath, []byte(v.initLua()), 0o755)
+	return journal.WriteFile(ctx, cfgPath, []byte(v.initLua()), 0o755)
 }
 
 const paqBootstrap = `-- boostrap paq
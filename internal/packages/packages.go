@@ -0,0 +1,186 @@
+// Package packages installs packages by their logical names, using whichever package manager the running distribution provides.
+package packages
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/danielmmetz/settle/internal/pkgmgr"
+	"github.com/danielmmetz/settle/internal/plan"
+)
+
+type Packages struct {
+	// Manager overrides the package manager otherwise detected from /etc/os-release, e.g. apt.
+	Manager string `json:"manager,omitempty"`
+	// Refresh updates the package index before installing missing packages.
+	Refresh bool `json:"refresh,omitempty"`
+	// Names overrides the built-in table of names under each package manager, keyed by logical name,
+	// e.g. fd: {apt: fd-find}.
+	Names map[string]map[string]string `json:"names,omitempty"`
+	Pkgs  []Pkg                        `json:"pkgs"`
+}
+
+// Pkg is a package known by a logical name, e.g. fd, which resolves to its name under each package manager, e.g. fd-find under apt.
+// It may be specified as either a bare name or a mapping.
+type Pkg struct {
+	Name string `json:"name"`
+	// Names maps package managers to the package's name under each, taking precedence over the stanza's names and the built-in table.
+	// An empty name skips the package under that manager.
+	Names map[string]string `json:"names,omitempty"`
+}
+
+func (p *Pkg) UnmarshalJSON(b []byte) error {
+	var name string
+	if err := json.Unmarshal(b, &name); err == nil {
+		*p = Pkg{Name: name}
+		return nil
+	}
+	type pkg Pkg
+	var intermediary pkg
+	if err := json.Unmarshal(b, &intermediary); err != nil {
+		return err
+	}
+	if intermediary.Name == "" {
+		return fmt.Errorf("package must specify a name")
+	}
+	*p = Pkg(intermediary)
+	return nil
+}
+
+func (p Pkg) MarshalJSON() ([]byte, error) {
+	if len(p.Names) == 0 {
+		return json.Marshal(p.Name)
+	}
+	type pkg Pkg
+	return json.Marshal(pkg(p))
+}
+
+// nameFor returns pkg's name under the given manager, reporting false if pkg is skipped under it.
+// Names declared by pkg take precedence over those declared by the stanza, which take precedence over the built-in table.
+func (p *Packages) nameFor(pkg Pkg, manager string) (string, bool) {
+	for _, names := range []map[string]string{pkg.Names, p.Names[pkg.Name], builtin[pkg.Name]} {
+		if name, ok := names[manager]; ok {
+			return name, name != ""
+		}
+	}
+	return pkg.Name, true
+}
+
+// NamesFor returns the names of the packages under the given manager.
+func (p *Packages) NamesFor(manager string) []string {
+	var names []string
+	for _, pkg := range p.Pkgs {
+		if name, ok := p.nameFor(pkg, manager); ok {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// UsesBrew reports whether the packages are to be installed with brew, as on macOS.
+func (p *Packages) UsesBrew() bool {
+	if p == nil {
+		return false
+	}
+	m, err := p.manager()
+	return err == nil && m.Name() == "brew"
+}
+
+func (p *Packages) UnmarshalJSON(b []byte) error {
+	if pkgs, ok := pkgmgr.BareList[Pkg](b); ok {
+		*p = Packages{Pkgs: pkgs}
+		return nil
+	}
+	type packages Packages
+	var intermediary packages
+	if err := json.Unmarshal(b, &intermediary); err != nil {
+		return err
+	}
+	if intermediary.Manager != "" {
+		if _, err := pkgmgr.For(intermediary.Manager); err != nil {
+			return err
+		}
+	}
+	*p = Packages(intermediary)
+	return nil
+}
+
+func (p *Packages) manager() (pkgmgr.Manager, error) {
+	if p.Manager != "" {
+		return pkgmgr.For(p.Manager)
+	}
+	return pkgmgr.Detect()
+}
+
+func (p *Packages) Ensure(ctx context.Context) error {
+	if p == nil {
+		return nil
+	}
+
+	m, err := p.manager()
+	if errors.Is(err, pkgmgr.ErrUnsupported) {
+		fmt.Printf("skipping packages: %v\n", err)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	installed, err := m.Installed(ctx)
+	if err != nil {
+		return err
+	}
+	names := p.NamesFor(m.Name())
+	var missing []string
+	for _, name := range names {
+		if _, ok := installed[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+	// packages declared as unavailable under the manager, by way of an empty name, are skipped rather than present
+	skipped := ""
+	if n := len(p.Pkgs) - len(names); n > 0 {
+		skipped = fmt.Sprintf(", %d unavailable via %s", n, m.Name())
+	}
+	if len(missing) == 0 {
+		fmt.Printf("all %d packages already present via %s%s\n", len(names), m.Name(), skipped)
+		return nil
+	}
+
+	// refreshing upgrades the whole system under some managers, which is worth calling out
+	upgrade := ""
+	if pkgmgr.RefreshUpgrades(m) {
+		upgrade = fmt.Sprintf(", upgrading all installed packages as %s doesn't support partial upgrades", m.Name())
+	}
+	if plan.Enabled(ctx) {
+		if p.Refresh {
+			fmt.Printf("would refresh the %s package index%s\n", m.Name(), upgrade)
+		}
+		for _, name := range missing {
+			version, err := m.Version(ctx, name)
+			if err != nil {
+				return err
+			}
+			if version == "" {
+				fmt.Printf("would install %s via %s, though it isn't currently available\n", name, m.Name())
+				continue
+			}
+			fmt.Printf("would install %s %s via %s\n", name, version, m.Name())
+		}
+		return nil
+	}
+	if p.Refresh {
+		fmt.Printf("refreshing the %s package index%s\n", m.Name(), upgrade)
+		if err := m.Refresh(ctx); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("installing %d missing packages via %s: %s\n", len(missing), m.Name(), strings.Join(missing, " "))
+	if err := m.Install(ctx, missing); err != nil {
+		return err
+	}
+	fmt.Printf("installed %d packages, %d already present%s\n", len(missing), len(names)-len(missing), skipped)
+	return nil
+}
@@ -0,0 +1,38 @@
+package packages
+
+import "testing"
+
+func TestNameFor(t *testing.T) {
+	p := &Packages{
+		Names: map[string]map[string]string{
+			"fd":      {"apt": "fd-stanza", "pacman": ""},
+			"ripgrep": {"dnf": "rg-stanza"},
+		},
+	}
+	tests := []struct {
+		name    string
+		pkg     Pkg
+		manager string
+		want    string
+		wantOK  bool
+	}{
+		{name: "builtin", pkg: Pkg{Name: "fd"}, manager: "dnf", want: "fd-find", wantOK: true},
+		{name: "stanza over builtin", pkg: Pkg{Name: "fd"}, manager: "apt", want: "fd-stanza", wantOK: true},
+		{name: "package over stanza", pkg: Pkg{Name: "fd", Names: map[string]string{"apt": "fd-pkg"}}, manager: "apt", want: "fd-pkg", wantOK: true},
+		{name: "package over builtin", pkg: Pkg{Name: "gh", Names: map[string]string{"pacman": "gh-pkg"}}, manager: "pacman", want: "gh-pkg", wantOK: true},
+		{name: "stanza without builtin", pkg: Pkg{Name: "ripgrep"}, manager: "dnf", want: "rg-stanza", wantOK: true},
+		{name: "logical name", pkg: Pkg{Name: "ripgrep"}, manager: "apt", want: "ripgrep", wantOK: true},
+		{name: "skipped by stanza", pkg: Pkg{Name: "fd"}, manager: "pacman", want: "", wantOK: false},
+		{name: "skipped by package", pkg: Pkg{Name: "fd", Names: map[string]string{"dnf": ""}}, manager: "dnf", want: "", wantOK: false},
+		{name: "package unskips", pkg: Pkg{Name: "fd", Names: map[string]string{"pacman": "fd"}}, manager: "pacman", want: "fd", wantOK: true},
+		{name: "unknown manager", pkg: Pkg{Name: "fd"}, manager: "nix", want: "fd", wantOK: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := p.nameFor(tt.pkg, tt.manager)
+			if got != tt.want || ok != tt.wantOK {
+				t.Fatalf("got %q, %t, want %q, %t", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package packages
+
+// builtin maps the logical names of common tools to their names under each package manager,
+// for those managers under which the name differs. Otherwise, the logical name is used as is.
+var builtin = map[string]map[string]string{
+	"7zip": {
+		"brew":   "p7zip",
+		"apt":    "p7zip-full",
+		"pacman": "p7zip",
+		"dnf":    "p7zip",
+		"apk":    "p7zip",
+		"zypper": "p7zip",
+	},
+	"ag": {
+		"brew":   "the_silver_searcher",
+		"apt":    "silversearcher-ag",
+		"pacman": "the_silver_searcher",
+		"dnf":    "the_silver_searcher",
+		"apk":    "the_silver_searcher",
+		"zypper": "the_silver_searcher",
+	},
+	"ctags": {
+		"brew": "universal-ctags",
+		"apt":  "universal-ctags",
+	},
+	"delta": {
+		"brew":   "git-delta",
+		"apt":    "git-delta",
+		"pacman": "git-delta",
+		"dnf":    "git-delta",
+		"zypper": "git-delta",
+	},
+	"dig": {
+		"brew":   "bind",
+		"apt":    "dnsutils",
+		"pacman": "bind",
+		"dnf":    "bind-utils",
+		"apk":    "bind-tools",
+		"zypper": "bind-utils",
+	},
+	"fd": {
+		"apt": "fd-find",
+		"dnf": "fd-find",
+	},
+	"gh": {
+		"pacman": "github-cli",
+		"apk":    "github-cli",
+	},
+	"go": {
+		"apt": "golang-go",
+		"dnf": "golang",
+	},
+	"gpg": {
+		"brew":   "gnupg",
+		"apt":    "gnupg",
+		"pacman": "gnupg",
+		"dnf":    "gnupg2",
+		"apk":    "gnupg",
+		"zypper": "gpg2",
+	},
+	"netcat": {
+		"apt":    "netcat-openbsd",
+		"pacman": "openbsd-netcat",
+		"dnf":    "nmap-ncat",
+		"apk":    "netcat-openbsd",
+		"zypper": "netcat-openbsd",
+	},
+	"node": {
+		"apt":    "nodejs",
+		"pacman": "nodejs",
+		"dnf":    "nodejs",
+		"apk":    "nodejs",
+		"zypper": "nodejs",
+	},
+	"python": {
+		"apt":    "python3",
+		"dnf":    "python3",
+		"apk":    "python3",
+		"zypper": "python3",
+	},
+	"shellcheck": {
+		"dnf":    "ShellCheck",
+		"zypper": "ShellCheck",
+	},
+	"ssh": {
+		"brew":   "openssh",
+		"apt":    "openssh-client",
+		"pacman": "openssh",
+		"dnf":    "openssh-clients",
+		"apk":    "openssh-client",
+		"zypper": "openssh-clients",
+	},
+}
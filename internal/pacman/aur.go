@@ -0,0 +1,175 @@
+package pacman
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/danielmmetz/settle/internal/plan"
+	"github.com/danielmmetz/settle/internal/privilege"
+	"github.com/danielmmetz/settle/internal/stream"
+)
+
+// helpers are the supported AUR helpers. Each is bootstrapped from the AUR package of its prebuilt binary.
+var helpers = map[string]string{
+	"paru": "paru-bin",
+	"yay":  "yay-bin",
+}
+
+// helper returns the configured AUR helper.
+func (p *Pacman) helper() string {
+	if p.AURHelper == "" {
+		return "paru"
+	}
+	return p.AURHelper
+}
+
+// ensureAUR installs the missing AUR packages by means of the AUR helper, bootstrapping the helper if needed.
+func (p *Pacman) ensureAUR(ctx context.Context, installed map[string]string) error {
+	if len(p.AUR) == 0 {
+		return nil
+	}
+	var missing []string
+	for _, pkg := range p.AUR {
+		if _, ok := installed[pkg.Name]; !ok {
+			missing = append(missing, pkg.Name)
+		}
+	}
+	if len(missing) == 0 {
+		fmt.Printf("all %d AUR packages already present\n", len(p.AUR))
+		return nil
+	}
+
+	helper := p.helper()
+	if plan.Enabled(ctx) {
+		if _, err := exec.LookPath(helper); err != nil {
+			fmt.Printf("would bootstrap AUR helper %s from %s\n", helper, helpers[helper])
+		}
+		fmt.Printf("would install %d AUR packages with %s: %s\n", len(missing), helper, strings.Join(missing, " "))
+		return nil
+	}
+	if err := p.bootstrapHelper(ctx, helper); err != nil {
+		return fmt.Errorf("error bootstrapping AUR helper %s: %w", helper, err)
+	}
+
+	fmt.Printf("installing %d AUR packages with `%s -S`: %s\n", len(missing), helper, strings.Join(missing, " "))
+	// the helper escalates by itself to install what it builds, but its stdin isn't a terminal from which to prompt for a password,
+	// so it escalates as settle does, relying on the credentials settle obtained up front and keeping them alive for long builds
+	if err := privilege.From(ctx).Prime(ctx); err != nil {
+		return err
+	}
+	escalate := privilege.From(ctx).Args()
+	args := []string{"-S", "--needed", "--noconfirm", "--sudoloop", "--sudo", escalate[0]}
+	if len(escalate) > 1 {
+		args = append(args, "--sudoflags", strings.Join(escalate[1:], " "))
+	}
+	// paru and yay pass --config through to pacman
+	installCmd, err := asUser(ctx, helper, p.confArgs(append(args, missing...)...)...)
+	if err != nil {
+		return err
+	}
+	if output, err := stream.Run(ctx, installCmd); err != nil {
+		return fmt.Errorf("error running `%s -S`: %w\n%s", helper, err, string(output))
+	}
+	return nil
+}
+
+// bootstrapHelper builds and installs helper from its AUR PKGBUILD, unless it's already installed.
+func (p *Pacman) bootstrapHelper(ctx context.Context, helper string) error {
+	if _, err := exec.LookPath(helper); err == nil {
+		return nil
+	}
+	pkgbase := helpers[helper]
+	fmt.Printf("bootstrapping AUR helper %s from %s\n", helper, pkgbase)
+	prereqArgs := p.manager().Args("-S", "--needed", "--noconfirm", "base-devel", "git")
+	prereqCmd := privilege.Command(ctx, prereqArgs[0], prereqArgs[1:]...)
+	if output, err := stream.Run(ctx, prereqCmd); err != nil {
+		return fmt.Errorf("error installing prerequisites: %w\n%s", err, string(output))
+	}
+
+	dir, err := os.MkdirTemp("", "settle-"+pkgbase)
+	if err != nil {
+		return fmt.Errorf("error creating build directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+	// the build runs as the invoking user, who must be able to write to the build directory
+	if uid, gid, ok := sudoUser(); ok {
+		if err := os.Chown(dir, uid, gid); err != nil {
+			return fmt.Errorf("error changing owner of build directory: %w", err)
+		}
+	}
+
+	cloneCmd, err := asUser(ctx, "git", "clone", "--depth=1", "https://aur.archlinux.org/"+pkgbase+".git", filepath.Join(dir, pkgbase))
+	if err != nil {
+		return err
+	}
+	if output, err := stream.Run(ctx, cloneCmd); err != nil {
+		return fmt.Errorf("error cloning %s: %w\n%s", pkgbase, err, string(output))
+	}
+	// makepkg is left to build alone, as it would otherwise escalate by itself, prompting on a stdin that isn't a terminal,
+	// and its package is instead installed as settle installs any other
+	buildCmd, err := asUser(ctx, "makepkg", "--noconfirm")
+	if err != nil {
+		return err
+	}
+	buildCmd.Dir = filepath.Join(dir, pkgbase)
+	if output, err := stream.Run(ctx, buildCmd); err != nil {
+		return fmt.Errorf("error running `makepkg`: %w\n%s", err, string(output))
+	}
+	listCmd, err := asUser(ctx, "makepkg", "--packagelist")
+	if err != nil {
+		return err
+	}
+	listCmd.Dir = buildCmd.Dir
+	output, err := listCmd.Output()
+	if err != nil {
+		return fmt.Errorf("error running `makepkg --packagelist`: %w", err)
+	}
+	var built []string
+	for _, path := range strings.Fields(string(output)) {
+		// the list includes debug packages, which are only built if enabled
+		if _, err := os.Stat(path); err == nil {
+			built = append(built, path)
+		}
+	}
+	if len(built) == 0 {
+		return fmt.Errorf("makepkg built no packages for %s", pkgbase)
+	}
+	installArgs := p.manager().Args(append([]string{"-U", "--noconfirm"}, built...)...)
+	installCmd := privilege.Command(ctx, installArgs[0], installArgs[1:]...)
+	if output, err := stream.Run(ctx, installCmd); err != nil {
+		return fmt.Errorf("error installing %s: %w\n%s", pkgbase, err, string(output))
+	}
+	return nil
+}
+
+// asUser returns a command that runs as the invoking non-root user, as required by makepkg and AUR helpers.
+// When running as root, that's the user that invoked sudo, as whom the command is run by way of the configured escalation command.
+func asUser(ctx context.Context, name string, args ...string) (*exec.Cmd, error) {
+	if os.Geteuid() != 0 {
+		return exec.CommandContext(ctx, name, args...), nil
+	}
+	user := os.Getenv("SUDO_USER")
+	if user == "" || user == "root" {
+		return nil, fmt.Errorf("AUR packages must be built as a non-root user: run settle as a regular user or via sudo")
+	}
+	return privilege.From(ctx).UserCommand(ctx, user, name, args...), nil
+}
+
+// sudoUser returns the ids of the user that invoked sudo, if running as root via sudo.
+func sudoUser() (int, int, bool) {
+	if os.Geteuid() != 0 {
+		return 0, 0, false
+	}
+	var uid, gid int
+	if _, err := fmt.Sscan(os.Getenv("SUDO_UID"), &uid); err != nil {
+		return 0, 0, false
+	}
+	if _, err := fmt.Sscan(os.Getenv("SUDO_GID"), &gid); err != nil {
+		return 0, 0, false
+	}
+	return uid, gid, true
+}
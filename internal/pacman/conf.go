@@ -0,0 +1,244 @@
+package pacman
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/danielmmetz/settle/internal/plan"
+	"github.com/danielmmetz/settle/internal/privilege"
+	"github.com/danielmmetz/settle/internal/stream"
+	"github.com/danielmmetz/settle/internal/sysfile"
+)
+
+const defaultConfPath = "/etc/pacman.conf"
+
+// Settle owns two blocks within pacman.conf: one at the end of the [options] section,
+// such that its settings take precedence over those preceding it, and one at the end of the file for repositories.
+const (
+	optionsBegin = "# BEGIN settle managed options"
+	optionsEnd   = "# END settle managed options"
+	reposBegin   = "# BEGIN settle managed repositories"
+	reposEnd     = "# END settle managed repositories"
+)
+
+// Repo is an additional pacman repository.
+type Repo struct {
+	Name string `json:"name"`
+	// Servers are the repository's server URLs. Either Servers or Include must be specified.
+	Servers []string `json:"servers,omitempty"`
+	// Include is the path of a mirrorlist file for the repository.
+	Include  string `json:"include,omitempty"`
+	SigLevel string `json:"sig_level,omitempty"`
+}
+
+// lines returns the section for r, preceded by a blank line to separate it from whatever precedes it.
+func (r Repo) lines() []string {
+	lines := []string{"", "[" + r.Name + "]"}
+	if r.SigLevel != "" {
+		lines = append(lines, "SigLevel = "+r.SigLevel)
+	}
+	for _, server := range r.Servers {
+		lines = append(lines, "Server = "+server)
+	}
+	if r.Include != "" {
+		lines = append(lines, "Include = "+r.Include)
+	}
+	return lines
+}
+
+func (p *Pacman) confPath() string {
+	if p.Conf == "" {
+		return defaultConfPath
+	}
+	return p.Conf
+}
+
+// ensureConf writes the options and repositories declared by p into settle-owned blocks within pacman.conf,
+// having first imported and locally signed the declared keys.
+// It reports whether the repositories changed, in which case the sync database must be refreshed.
+func (p *Pacman) ensureConf(ctx context.Context) (bool, error) {
+	if err := p.ensureKeys(ctx); err != nil {
+		return false, err
+	}
+
+	path := p.confPath()
+	existing, err := os.ReadFile(path)
+	if err != nil {
+		return false, fmt.Errorf("error reading %s: %w", path, err)
+	}
+	options, err := p.optionLines()
+	if err != nil {
+		return false, err
+	}
+	var repos []string
+	for i, r := range p.Repos {
+		if r.Name == "" || (len(r.Servers) == 0 && r.Include == "") {
+			return false, fmt.Errorf("repository %d: a name and either servers or include are required", i)
+		}
+		repos = append(repos, r.lines()...)
+	}
+
+	withOptions, err := withBlock(string(existing), optionsBegin, optionsEnd, options, endOfOptions)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", path, err)
+	}
+	updated, err := withBlock(withOptions, reposBegin, reposEnd, repos, endOfFile)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", path, err)
+	}
+	if updated == string(existing) {
+		return false, nil
+	}
+	reposChanged := block(string(existing), reposBegin, reposEnd) != block(updated, reposBegin, reposEnd)
+	if _, err := sysfile.WriteFile(ctx, path, []byte(updated)); err != nil {
+		return false, err
+	}
+	return reposChanged, nil
+}
+
+// optionLines returns the lines for the [options] block: declared options followed by IgnorePkg for held packages.
+// Boolean options are written bare when true and omitted when false.
+func (p *Pacman) optionLines() ([]string, error) {
+	names := make([]string, 0, len(p.Options))
+	for name := range p.Options {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var lines []string
+	for _, name := range names {
+		switch v := p.Options[name].(type) {
+		case bool:
+			if v {
+				lines = append(lines, name)
+			}
+		case string:
+			lines = append(lines, fmt.Sprintf("%s = %s", name, v))
+		case float64:
+			lines = append(lines, fmt.Sprintf("%s = %v", name, v))
+		default:
+			return nil, fmt.Errorf("option %s: unsupported value %v", name, v)
+		}
+	}
+
+	var held []string
+	for _, pkg := range p.allPkgs() {
+		if pkg.Hold {
+			held = append(held, pkg.Name)
+		}
+	}
+	if len(held) > 0 {
+		lines = append(lines, "IgnorePkg = "+strings.Join(held, " "))
+	}
+	return lines, nil
+}
+
+// ensureKeys imports and locally signs each declared key not already in the pacman keyring.
+func (p *Pacman) ensureKeys(ctx context.Context) error {
+	for _, key := range p.Keys {
+		if err := exec.CommandContext(ctx, "pacman-key", p.confArgs("--list-keys", key)...).Run(); err == nil {
+			continue
+		}
+		if plan.Enabled(ctx) {
+			fmt.Println("would import and locally sign pacman key", key)
+			continue
+		}
+		fmt.Println("importing and locally signing pacman key", key)
+		for _, args := range [][]string{{"--recv-keys", key}, {"--lsign-key", key}} {
+			keyCmd := privilege.Command(ctx, "pacman-key", p.confArgs(args...)...)
+			if output, err := stream.Run(ctx, keyCmd); err != nil {
+				return fmt.Errorf("error running `pacman-key %s`: %w\n%s", args[0], err, string(output))
+			}
+		}
+	}
+	return nil
+}
+
+// confArgs returns args preceded by --config Conf, if set, as accepted by pacman-key and the AUR helpers.
+func (p *Pacman) confArgs(args ...string) []string {
+	if p.Conf == "" {
+		return args
+	}
+	return append([]string{"--config", p.Conf}, args...)
+}
+
+// placement returns the index at which a block is inserted into lines.
+type placement func(lines []string) (int, error)
+
+func endOfOptions(lines []string) (int, error) {
+	start := -1
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "[options]":
+			start = i
+		case start != -1 && strings.HasPrefix(trimmed, "["):
+			// back up over the blank lines and comments introducing the next section
+			end := i
+			for end > start+1 && (strings.TrimSpace(lines[end-1]) == "" || strings.HasPrefix(strings.TrimSpace(lines[end-1]), "#")) {
+				end--
+			}
+			return end, nil
+		}
+	}
+	if start == -1 {
+		return 0, errors.New("no [options] section found")
+	}
+	// [options] is the last section, so the block goes ahead of any trailing blank lines
+	return endOfFile(lines)
+}
+
+func endOfFile(lines []string) (int, error) {
+	end := len(lines)
+	for end > 0 && strings.TrimSpace(lines[end-1]) == "" {
+		end--
+	}
+	return end, nil
+}
+
+// withBlock returns conf with the block delimited by begin and end replaced by lines, inserted at the given placement.
+// If lines is empty, the block is removed.
+func withBlock(conf, begin, end string, lines []string, at placement) (string, error) {
+	var kept []string
+	inBlock := false
+	for _, line := range strings.Split(conf, "\n") {
+		switch strings.TrimSpace(line) {
+		case begin:
+			inBlock = true
+			continue
+		case end:
+			inBlock = false
+			continue
+		}
+		if !inBlock {
+			kept = append(kept, line)
+		}
+	}
+	if len(lines) == 0 {
+		return strings.Join(kept, "\n"), nil
+	}
+
+	i, err := at(kept)
+	if err != nil {
+		return "", err
+	}
+	updated := make([]string, 0, len(kept)+len(lines)+2)
+	updated = append(updated, kept[:i]...)
+	updated = append(updated, begin)
+	updated = append(updated, lines...)
+	updated = append(updated, end)
+	updated = append(updated, kept[i:]...)
+	return strings.Join(updated, "\n"), nil
+}
+
+// block returns the contents of the block delimited by begin and end within conf.
+func block(conf, begin, end string) string {
+	_, rest, _ := strings.Cut(conf, begin)
+	contents, _, _ := strings.Cut(rest, end)
+	return contents
+}
@@ -0,0 +1,209 @@
+package pacman
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testConf = `[options]
+HoldPkg     = pacman glibc
+Architecture = auto
+
+# repositories follow
+[core]
+Include = /etc/pacman.d/mirrorlist
+`
+
+func TestWithBlock(t *testing.T) {
+	tests := []struct {
+		name string
+		conf string
+		// repos selects the repositories block rather than the options block.
+		repos   bool
+		lines   []string
+		at      placement
+		want    string
+		wantErr string
+	}{
+		{
+			name:  "insert at end of options",
+			conf:  testConf,
+			lines: []string{"Color"},
+			at:    endOfOptions,
+			want: `[options]
+HoldPkg     = pacman glibc
+Architecture = auto
+# BEGIN settle managed options
+Color
+# END settle managed options
+
+# repositories follow
+[core]
+Include = /etc/pacman.d/mirrorlist
+`,
+		},
+		{
+			name: "replace existing block",
+			conf: `[options]
+# BEGIN settle managed options
+Color
+# END settle managed options
+`,
+			lines: []string{"ParallelDownloads = 5"},
+			at:    endOfOptions,
+			want: `[options]
+# BEGIN settle managed options
+ParallelDownloads = 5
+# END settle managed options
+`,
+		},
+		{
+			name: "remove block",
+			conf: `[options]
+Architecture = auto
+# BEGIN settle managed options
+Color
+# END settle managed options
+`,
+			at: endOfOptions,
+			want: `[options]
+Architecture = auto
+`,
+		},
+		{
+			name:  "insert at end of file",
+			conf:  testConf + "\n\n",
+			repos: true,
+			lines: []string{"", "[custom]", "Server = https://example.com"},
+			at:    endOfFile,
+			want: testConf + `# BEGIN settle managed repositories
+
+[custom]
+Server = https://example.com
+# END settle managed repositories
+
+
+`,
+		},
+		{
+			name:    "no options section",
+			conf:    "[core]\n",
+			lines:   []string{"Color"},
+			at:      endOfOptions,
+			wantErr: "no [options] section found",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			begin, end := optionsBegin, optionsEnd
+			if tt.repos {
+				begin, end = reposBegin, reposEnd
+			}
+			got, err := withBlock(tt.conf, begin, end, tt.lines, tt.at)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEnsureConf(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pacman.conf")
+	if err := os.WriteFile(path, []byte(testConf), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	p := &Pacman{
+		Conf:    path,
+		Options: map[string]any{"Color": true, "ParallelDownloads": float64(5)},
+		Repos:   []Repo{{Name: "custom", Servers: []string{"https://example.com/$arch"}}},
+		Pkgs:    []Pkg{{Name: "linux", Hold: true}},
+	}
+	want := `[options]
+HoldPkg     = pacman glibc
+Architecture = auto
+# BEGIN settle managed options
+Color
+ParallelDownloads = 5
+IgnorePkg = linux
+# END settle managed options
+
+# repositories follow
+[core]
+Include = /etc/pacman.d/mirrorlist
+# BEGIN settle managed repositories
+
+[custom]
+Server = https://example.com/$arch
+# END settle managed repositories
+`
+	read := func() string {
+		t.Helper()
+		b, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+	ctx := context.Background()
+
+	steps := []struct {
+		name string
+		// edit modifies the file ahead of the step, if set.
+		edit             func(string) string
+		want             string
+		wantReposChanged bool
+	}{
+		{
+			name:             "first write",
+			want:             want,
+			wantReposChanged: true,
+		},
+		{
+			name: "idempotent rewrite",
+			want: want,
+		},
+		{
+			name: "user edit outside the block",
+			edit: func(conf string) string {
+				return strings.Replace(conf, "HoldPkg     = pacman glibc", "HoldPkg     = pacman glibc\nCheckSpace", 1)
+			},
+			want: strings.Replace(want, "HoldPkg     = pacman glibc", "HoldPkg     = pacman glibc\nCheckSpace", 1),
+		},
+		{
+			name: "user edit inside the block",
+			edit: func(conf string) string {
+				return strings.Replace(conf, "ParallelDownloads = 5", "ParallelDownloads = 10", 1)
+			},
+			want: strings.Replace(want, "HoldPkg     = pacman glibc", "HoldPkg     = pacman glibc\nCheckSpace", 1),
+		},
+	}
+	for _, step := range steps {
+		if step.edit != nil {
+			if err := os.WriteFile(path, []byte(step.edit(read())), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		reposChanged, err := p.ensureConf(ctx)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", step.name, err)
+		}
+		if reposChanged != step.wantReposChanged {
+			t.Errorf("%s: expected repos changed %t, got %t", step.name, step.wantReposChanged, reposChanged)
+		}
+		if got := read(); got != step.want {
+			t.Errorf("%s: got:\n%s\nwant:\n%s", step.name, got, step.want)
+		}
+	}
+}
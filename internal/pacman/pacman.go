@@ -2,23 +2,200 @@ package pacman
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
-	"os/exec"
+	"strings"
+
+	"github.com/danielmmetz/settle/internal/pkgmgr"
+	"github.com/danielmmetz/settle/internal/plan"
+)
+
+type Pacman struct {
+	Pkgs []Pkg `json:"pkgs"`
+	// AUR lists packages installed from the AUR by means of AURHelper.
+	AUR []Pkg `json:"aur,omitempty"`
+	// AURHelper is the AUR helper to use, either paru (the default) or yay.
+	// It's bootstrapped from the AUR if not already installed.
+	AURHelper string `json:"aur_helper,omitempty"`
+	// Refresh controls when the sync database is refreshed. See the Refresh constants.
+	Refresh Refresh `json:"refresh,omitempty"`
+	// Prune opts in to removing explicitly installed packages that aren't declared in Pkgs.
+	Prune *pkgmgr.Prune `json:"prune,omitempty"`
+
+	// Conf is the path of pacman.conf, within which settle manages Options, Repos, and IgnorePkg for held packages.
+	// It defaults to /etc/pacman.conf. Otherwise, pacman, pacman-key, and the AUR helper are passed --config Conf.
+	Conf string `json:"conf,omitempty"`
+	// Options are [options] settings, e.g. ParallelDownloads: 5 or Color: true.
+	Options map[string]any `json:"options,omitempty"`
+	Repos   []Repo         `json:"repos,omitempty"`
+	// Keys are the ids of keys to import and locally sign with pacman-key, e.g. for signed Repos.
+	Keys []string `json:"keys,omitempty"`
+}
+
+// Refresh is a policy for refreshing the sync database.
+// Arch doesn't support partial upgrades, so refreshing always implies a full system upgrade.
+type Refresh string
+
+const (
+	// RefreshNever installs from the sync database as is. It's the default.
+	RefreshNever Refresh = "never"
+	// RefreshOnInstall refreshes and upgrades the system whenever packages are to be installed.
+	RefreshOnInstall Refresh = "on-install"
+	// RefreshAlways refreshes and upgrades the system on every run.
+	RefreshAlways Refresh = "always"
 )
 
-type Pacman []string
+func (p *Pacman) UnmarshalJSON(b []byte) error {
+	if pkgs, ok := pkgmgr.BareList[Pkg](b); ok {
+		*p = Pacman{Pkgs: pkgs}
+		return nil
+	}
+	type pacman Pacman
+	var intermediary pacman
+	if err := json.Unmarshal(b, &intermediary); err != nil {
+		return err
+	}
+	if _, ok := helpers[intermediary.AURHelper]; !ok && intermediary.AURHelper != "" {
+		return fmt.Errorf("unsupported AUR helper %q: expected paru or yay", intermediary.AURHelper)
+	}
+	switch intermediary.Refresh {
+	case "":
+		intermediary.Refresh = RefreshNever
+	case RefreshNever, RefreshOnInstall, RefreshAlways:
+	default:
+		return fmt.Errorf("invalid refresh policy %q: expected %q, %q, or %q", intermediary.Refresh, RefreshNever, RefreshOnInstall, RefreshAlways)
+	}
+	*p = Pacman(intermediary)
+	return nil
+}
 
 func (p *Pacman) Ensure(ctx context.Context) error {
 	if p == nil {
 		return nil
 	}
 
-	cmd := []string{"pacman", "-S", "--noconfirm"}
-	cmd = append(cmd, *p...)
-	fmt.Println("installing packages with `sudo pacman -S --noconfirm`")
-	installCmd := exec.CommandContext(ctx, "sudo", cmd...)
-	if output, err := installCmd.CombinedOutput(); err != nil {
-		return fmt.Errorf("error running `pacman`: %w\n%s", err, string(output))
+	reposChanged, err := p.ensureConf(ctx)
+	if err != nil {
+		return fmt.Errorf("error ensuring pacman.conf: %w", err)
 	}
+
+	installed, err := p.manager().Installed(ctx)
+	if err != nil {
+		return err
+	}
+	var missing []string
+	for _, pkg := range p.Pkgs {
+		if _, ok := installed[pkg.Name]; !ok {
+			missing = append(missing, pkg.Name)
+		}
+	}
+	if err := p.install(ctx, missing, reposChanged); err != nil {
+		return err
+	}
+	if err := p.ensureAUR(ctx, installed); err != nil {
+		return err
+	}
+	if !plan.Enabled(ctx) {
+		if installed, err = p.manager().Installed(ctx); err != nil {
+			return err
+		}
+	}
+	for _, pkg := range p.allPkgs() {
+		if version, ok := installed[pkg.Name]; ok && !pkg.matches(version) {
+			// pacman only installs the version offered by the sync database, so drift is reported rather than corrected
+			fmt.Printf("pacman package %s has drifted: installed version %s, want %s\n", pkg.Name, version, pkg.Version)
+		}
+	}
+	if p.Prune == nil {
+		return nil
+	}
+	return p.prune(ctx)
+}
+
+// manager returns the pacman adapter, reading the configured pacman.conf.
+func (p *Pacman) manager() pkgmgr.Pacman {
+	return pkgmgr.Pacman{Conf: p.Conf}
+}
+
+// allPkgs returns both the repository and AUR packages.
+func (p *Pacman) allPkgs() []Pkg {
+	all := make([]Pkg, 0, len(p.Pkgs)+len(p.AUR))
+	return append(append(all, p.Pkgs...), p.AUR...)
+}
+
+// install installs the missing packages, refreshing the sync database per p's refresh policy,
+// or if the configured repositories changed.
+func (p *Pacman) install(ctx context.Context, missing []string, reposChanged bool) error {
+	refresh := reposChanged || p.Refresh == RefreshAlways || (p.Refresh == RefreshOnInstall && len(missing) > 0)
+	if len(missing) == 0 && !refresh {
+		fmt.Printf("all %d pacman packages already present\n", len(p.Pkgs))
+		return nil
+	}
+
+	if plan.Enabled(ctx) {
+		if refresh {
+			fmt.Println("would refresh the sync database and upgrade the system")
+		}
+		if len(missing) > 0 {
+			fmt.Printf("would install %d pacman packages: %s\n", len(missing), strings.Join(missing, " "))
+		}
+		return nil
+	}
+
+	if refresh {
+		fmt.Println("refreshing the sync database and upgrading the system with `pacman -Syu`")
+		if err := p.manager().Refresh(ctx); err != nil {
+			return err
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	fmt.Printf("installing %d packages with `pacman -S`: %s\n", len(missing), strings.Join(missing, " "))
+	if err := p.manager().Install(ctx, missing); err != nil {
+		return err
+	}
+	fmt.Printf("installed %d pacman packages, %d already present\n", len(missing), len(p.Pkgs)-len(missing))
 	return nil
 }
+
+// prune removes explicitly installed packages that nothing depends on and that are neither declared, allowed, nor protected,
+// along with their no longer needed dependencies.
+func (p *Pacman) prune(ctx context.Context) error {
+	leaves, err := p.manager().Leaves(ctx)
+	if err != nil {
+		return err
+	}
+	var declared []string
+	for _, pkg := range p.allPkgs() {
+		declared = append(declared, pkg.Name)
+	}
+	if len(p.AUR) > 0 {
+		declared = append(declared, p.helper(), helpers[p.helper()])
+	}
+	undeclared := p.Prune.Undeclared(p.manager(), leaves, declared)
+	if len(undeclared) == 0 {
+		fmt.Println("no undeclared pacman packages to prune")
+		return nil
+	}
+
+	if plan.Enabled(ctx) {
+		fmt.Printf("would prune %d undeclared pacman packages: %s\n", len(undeclared), strings.Join(undeclared, " "))
+		return nil
+	}
+	fmt.Printf("pruning %d undeclared packages with `pacman -Rns`: %s\n", len(undeclared), strings.Join(undeclared, " "))
+	return p.manager().Remove(ctx, undeclared)
+}
+
+// Current returns the explicitly installed packages, as reported by `pacman -Qqe`.
+func Current(ctx context.Context) (*Pacman, error) {
+	names, err := pkgmgr.Pacman{}.Explicit(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var p Pacman
+	for _, name := range names {
+		p.Pkgs = append(p.Pkgs, Pkg{Name: name})
+	}
+	return &p, nil
+}
@@ -0,0 +1,52 @@
+package pacman
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+)
+
+// Pkg is a pacman package, optionally pinned to a version.
+// It may be specified as either a bare name or a mapping.
+type Pkg struct {
+	Name string `json:"name"`
+	// Version is the expected version, which may be a glob pattern, e.g. 14.9-*.
+	Version string `json:"version,omitempty"`
+	// Hold excludes the package from upgrades by means of IgnorePkg in pacman.conf.
+	Hold bool `json:"hold,omitempty"`
+}
+
+func (p *Pkg) UnmarshalJSON(b []byte) error {
+	var name string
+	if err := json.Unmarshal(b, &name); err == nil {
+		*p = Pkg{Name: name}
+		return nil
+	}
+	type pkg Pkg
+	var intermediary pkg
+	if err := json.Unmarshal(b, &intermediary); err != nil {
+		return err
+	}
+	if intermediary.Name == "" {
+		return fmt.Errorf("package must specify a name")
+	}
+	*p = Pkg(intermediary)
+	return nil
+}
+
+func (p Pkg) MarshalJSON() ([]byte, error) {
+	if p.Version == "" && !p.Hold {
+		return json.Marshal(p.Name)
+	}
+	type pkg Pkg
+	return json.Marshal(pkg(p))
+}
+
+// matches reports whether the installed version satisfies p.
+func (p Pkg) matches(version string) bool {
+	if p.Version == "" {
+		return true
+	}
+	ok, err := path.Match(p.Version, version)
+	return err == nil && ok
+}
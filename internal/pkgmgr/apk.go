@@ -0,0 +1,73 @@
+package pkgmgr
+
+import (
+	"context"
+	"strings"
+)
+
+// Apk manages packages on Alpine.
+type Apk struct{}
+
+func (Apk) Name() string { return "apk" }
+
+func (Apk) Installed(ctx context.Context) (map[string]string, error) {
+	output, err := query(ctx, "apk", "info", "-v")
+	if err != nil {
+		return nil, err
+	}
+	installed := make(map[string]string)
+	for _, line := range strings.Fields(output) {
+		if name, version, ok := splitApkVersion(line); ok {
+			installed[name] = version
+		}
+	}
+	return installed, nil
+}
+
+func (Apk) Version(ctx context.Context, name string) (string, error) {
+	output, err := query(ctx, "apk", "search", "--exact", name)
+	if err != nil {
+		return "", err
+	}
+	for _, line := range strings.Fields(output) {
+		if n, version, ok := splitApkVersion(line); ok && n == name {
+			return version, nil
+		}
+	}
+	return "", nil
+}
+
+func (Apk) Install(ctx context.Context, names []string) error {
+	return privileged(ctx, append([]string{"apk", "add"}, names...)...)
+}
+
+// Remove removes names from the world file, and with them any dependencies no longer needed.
+func (Apk) Remove(ctx context.Context, names []string) error {
+	return privileged(ctx, append([]string{"apk", "del"}, names...)...)
+}
+
+func (Apk) Refresh(ctx context.Context) error {
+	return privileged(ctx, "apk", "update")
+}
+
+// apkProtected are packages that are never pruned, as doing so would leave the system unusable.
+var apkProtected = patterns{
+	"alpine-base", "alpine-baselayout", "alpine-keys", "apk-tools", "busybox", "ca-certificates-bundle", "libc-utils", "musl",
+}
+
+// Protected reports whether the named package is one that prune must never remove.
+func (Apk) Protected(name string) bool { return apkProtected.match(name) }
+
+// splitApkVersion splits a package of the form name-1.2.3-r0 into its name and version.
+// Names may contain hyphens but versions don't, such that the version begins after the second to last.
+func splitApkVersion(s string) (string, string, bool) {
+	release := strings.LastIndex(s, "-")
+	if release == -1 {
+		return "", "", false
+	}
+	version := strings.LastIndex(s[:release], "-")
+	if version == -1 {
+		return "", "", false
+	}
+	return s[:version], s[version+1:], true
+}
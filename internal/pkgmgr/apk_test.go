@@ -0,0 +1,24 @@
+package pkgmgr
+
+import "testing"
+
+func TestSplitApkVersion(t *testing.T) {
+	tests := []struct {
+		input   string
+		name    string
+		version string
+		ok      bool
+	}{
+		{input: "busybox-1.36.1-r29", name: "busybox", version: "1.36.1-r29", ok: true},
+		{input: "ca-certificates-bundle-20240705-r0", name: "ca-certificates-bundle", version: "20240705-r0", ok: true},
+		{input: "py3-setuptools-70.3.0-r0", name: "py3-setuptools", version: "70.3.0-r0", ok: true},
+		{input: "musl-r0"},
+		{input: "musl"},
+	}
+	for _, tt := range tests {
+		name, version, ok := splitApkVersion(tt.input)
+		if name != tt.name || version != tt.version || ok != tt.ok {
+			t.Errorf("splitApkVersion(%q) = %q, %q, %t, want %q, %q, %t", tt.input, name, version, ok, tt.name, tt.version, tt.ok)
+		}
+	}
+}
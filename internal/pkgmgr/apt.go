@@ -0,0 +1,112 @@
+package pkgmgr
+
+import (
+	"context"
+	"strings"
+)
+
+// Apt manages packages on Debian and its derivatives.
+type Apt struct {
+	// AllowHeld permits Install to change held packages, as is needed to install a held package at a different version.
+	AllowHeld bool
+}
+
+func (Apt) Name() string { return "apt" }
+
+func (a Apt) Installed(ctx context.Context) (map[string]string, error) {
+	pkgs, err := a.Packages(ctx)
+	if err != nil {
+		return nil, err
+	}
+	installed := make(map[string]string, len(pkgs))
+	for name, pkg := range pkgs {
+		installed[name] = pkg.Version
+	}
+	return installed, nil
+}
+
+// AptPackage describes an installed package.
+type AptPackage struct {
+	Version   string
+	Priority  string
+	Essential bool
+}
+
+// Base reports whether the package is part of the base system, and so should never be pruned.
+func (p AptPackage) Base() bool {
+	switch p.Priority {
+	case "required", "important", "standard":
+		return true
+	}
+	return p.Essential
+}
+
+// Packages returns the installed packages, as reported by `dpkg-query`.
+func (Apt) Packages(ctx context.Context) (map[string]AptPackage, error) {
+	output, err := query(ctx, "dpkg-query", "--show", "--showformat=${Package}\t${db:Status-Abbrev}\t${Version}\t${Priority}\t${Essential}\n")
+	if err != nil {
+		return nil, err
+	}
+	installed := make(map[string]AptPackage)
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) != 5 {
+			continue
+		}
+		// the second character of the abbreviated status is the current state, where "i" is installed
+		if status := fields[1]; len(status) < 2 || status[1] != 'i' {
+			continue
+		}
+		installed[fields[0]] = AptPackage{Version: fields[2], Priority: fields[3], Essential: fields[4] == "yes"}
+	}
+	return installed, nil
+}
+
+// Manual returns the packages marked as manually installed, as reported by `apt-mark showmanual`.
+func (Apt) Manual(ctx context.Context) ([]string, error) {
+	output, err := query(ctx, "apt-mark", "showmanual")
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(output), nil
+}
+
+func (Apt) Version(ctx context.Context, name string) (string, error) {
+	output, err := query(ctx, "apt-cache", "policy", name)
+	if err != nil {
+		return "", err
+	}
+	if candidate := field(output, "Candidate"); candidate != "(none)" {
+		return candidate, nil
+	}
+	return "", nil
+}
+
+// Install installs names, each of which may pin a version, e.g. ripgrep=14.1.0-1, noninteractively.
+func (a Apt) Install(ctx context.Context, names []string) error {
+	args := []string{"env", "DEBIAN_FRONTEND=noninteractive", "apt", "install", "-y", "--allow-downgrades"}
+	if a.AllowHeld {
+		args = append(args, "--allow-change-held-packages")
+	}
+	return privileged(ctx, append(args, names...)...)
+}
+
+func (Apt) Remove(ctx context.Context, names []string) error {
+	return privileged(ctx, append([]string{"env", "DEBIAN_FRONTEND=noninteractive", "apt", "remove", "-y"}, names...)...)
+}
+
+func (Apt) Refresh(ctx context.Context) error {
+	return privileged(ctx, "apt", "update")
+}
+
+// aptProtected match packages that, while not of base priority, a system can't boot, be reached, or be logged into without:
+// kernels, bootloaders, and the metapackages installers seed to pull in a desktop or server.
+var aptProtected = patterns{
+	"linux-image-*", "linux-headers-*", "linux-modules-*", "linux-generic*", "linux-virtual*", "linux-firmware", "*-microcode",
+	"grub-*", "grub2-*", "shim-signed", "systemd-boot", "efibootmgr", "initramfs-tools", "dracut",
+	"*-desktop", "*-desktop-*", "ubuntu-minimal", "ubuntu-standard", "ubuntu-server", "ubuntu-server-minimal", "task-*",
+	"openssh-server", "network-manager", "netplan.io", "ifupdown", "isc-dhcp-client", "wpasupplicant", "sudo", "cloud-init",
+}
+
+// Protected reports whether the named package is one that prune must never touch, despite not being part of the base system.
+func (Apt) Protected(name string) bool { return aptProtected.match(name) }
@@ -0,0 +1,62 @@
+package pkgmgr
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Brew manages formulae on macOS. Unlike the others, it runs unprivileged.
+type Brew struct{}
+
+func (Brew) Name() string { return "brew" }
+
+func (Brew) Installed(ctx context.Context) (map[string]string, error) {
+	output, err := query(ctx, "brew", "list", "--formula", "--versions")
+	if err != nil {
+		return nil, err
+	}
+	installed := make(map[string]string)
+	for _, line := range strings.Split(output, "\n") {
+		// each line lists a formula followed by its installed versions, oldest first
+		fields := strings.Fields(line)
+		if len(fields) > 1 {
+			installed[fields[0]] = fields[len(fields)-1]
+		}
+	}
+	return installed, nil
+}
+
+func (Brew) Version(ctx context.Context, name string) (string, error) {
+	output, err := query(ctx, "brew", "info", "--json=v2", "--formula", name)
+	if err != nil {
+		return "", err
+	}
+	var info struct {
+		Formulae []struct {
+			Versions struct {
+				Stable string `json:"stable"`
+			} `json:"versions"`
+		} `json:"formulae"`
+	}
+	if err := json.Unmarshal([]byte(output), &info); err != nil {
+		return "", fmt.Errorf("error parsing `brew info` output: %w", err)
+	}
+	if len(info.Formulae) == 0 {
+		return "", nil
+	}
+	return info.Formulae[0].Versions.Stable, nil
+}
+
+func (Brew) Install(ctx context.Context, names []string) error {
+	return run(ctx, append([]string{"brew", "install"}, names...)...)
+}
+
+func (Brew) Remove(ctx context.Context, names []string) error {
+	return run(ctx, append([]string{"brew", "uninstall"}, names...)...)
+}
+
+func (Brew) Refresh(ctx context.Context) error {
+	return run(ctx, "brew", "update")
+}
@@ -0,0 +1,96 @@
+package pkgmgr
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"strings"
+)
+
+// Pacman manages packages on Arch and its derivatives.
+type Pacman struct {
+	// Conf is the path of an alternate pacman.conf, passed to pacman as --config. It defaults to pacman's own default.
+	Conf string
+}
+
+// Args returns the pacman command line for args, reading the alternate pacman.conf if there is one.
+func (p Pacman) Args(args ...string) []string {
+	if p.Conf == "" {
+		return append([]string{"pacman"}, args...)
+	}
+	return append([]string{"pacman", "--config", p.Conf}, args...)
+}
+
+func (Pacman) Name() string { return "pacman" }
+
+func (p Pacman) Installed(ctx context.Context) (map[string]string, error) {
+	output, err := query(ctx, p.Args("-Q")...)
+	if err != nil {
+		return nil, err
+	}
+	installed := make(map[string]string)
+	for _, line := range strings.Split(output, "\n") {
+		if name, version, ok := strings.Cut(line, " "); ok {
+			installed[name] = version
+		}
+	}
+	return installed, nil
+}
+
+// Explicit returns the explicitly installed packages, as reported by `pacman -Qqe`.
+func (p Pacman) Explicit(ctx context.Context) ([]string, error) {
+	output, err := query(ctx, p.Args("-Qqe")...)
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(output), nil
+}
+
+// Leaves returns the explicitly installed packages that no other package depends on, as reported by `pacman -Qqet`.
+func (p Pacman) Leaves(ctx context.Context) ([]string, error) {
+	output, err := query(ctx, p.Args("-Qqet")...)
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(output), nil
+}
+
+func (p Pacman) Version(ctx context.Context, name string) (string, error) {
+	output, err := query(ctx, p.Args("-Si", name)...)
+	if exitErr := (*exec.ExitError)(nil); errors.As(err, &exitErr) {
+		// pacman exits non-zero if no sync database offers the package
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return field(output, "Version"), nil
+}
+
+func (p Pacman) Install(ctx context.Context, names []string) error {
+	return privileged(ctx, p.Args(append([]string{"-S", "--needed", "--noconfirm"}, names...)...)...)
+}
+
+// Remove removes names along with their no longer needed dependencies.
+func (p Pacman) Remove(ctx context.Context, names []string) error {
+	return privileged(ctx, p.Args(append([]string{"-Rns", "--noconfirm"}, names...)...)...)
+}
+
+// RefreshUpgrades reports that Refresh upgrades the system.
+func (Pacman) RefreshUpgrades() bool { return true }
+
+// Refresh refreshes the sync database and upgrades the system, as Arch doesn't support partial upgrades.
+func (p Pacman) Refresh(ctx context.Context) error {
+	return privileged(ctx, p.Args("-Syu", "--noconfirm")...)
+}
+
+// pacmanProtected match packages that are never pruned, as doing so would leave the system unable to boot, update, or be reached:
+// the base meta packages, kernels and their firmware, microcode, bootloaders, initramfs generators, and networking.
+var pacmanProtected = patterns{
+	"base", "base-devel", "linux", "linux-*", "*-ucode", "pacman", "sudo",
+	"grub", "efibootmgr", "systemd", "systemd-*", "refind", "syslinux", "mkinitcpio", "mkinitcpio-*", "dracut", "booster",
+	"networkmanager", "iwd", "dhcpcd", "netctl", "wpa_supplicant", "openssh",
+}
+
+// Protected reports whether the named package is one that prune must never remove.
+func (Pacman) Protected(name string) bool { return pacmanProtected.match(name) }
@@ -0,0 +1,167 @@
+// Package pkgmgr abstracts over the package managers of the supported systems: brew on macOS, and apt, pacman, dnf, apk, or zypper on Linux.
+package pkgmgr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/danielmmetz/settle/internal/privilege"
+	"github.com/danielmmetz/settle/internal/stream"
+)
+
+// Manager is a system package manager.
+type Manager interface {
+	// Name identifies the manager, and matches the name of its stanza, e.g. apt.
+	Name() string
+	// Installed returns the installed packages and their versions.
+	Installed(ctx context.Context) (map[string]string, error)
+	// Version returns the version of the named package that would be installed, or the empty string if none is available.
+	Version(ctx context.Context, name string) (string, error)
+	Install(ctx context.Context, names []string) error
+	Remove(ctx context.Context, names []string) error
+	// Refresh updates the manager's package index.
+	Refresh(ctx context.Context) error
+}
+
+// Upgrader is implemented by managers whose Refresh also upgrades the installed packages, as pacman's does.
+type Upgrader interface {
+	// RefreshUpgrades reports whether Refresh upgrades the installed packages.
+	RefreshUpgrades() bool
+}
+
+// RefreshUpgrades reports whether m's Refresh upgrades the installed packages.
+func RefreshUpgrades(m Manager) bool {
+	u, ok := m.(Upgrader)
+	return ok && u.RefreshUpgrades()
+}
+
+// ErrUnsupported indicates that no supported package manager could be determined.
+var ErrUnsupported = errors.New("unsupported distribution")
+
+var managers = map[string]Manager{
+	"brew":   Brew{},
+	"apt":    Apt{},
+	"pacman": Pacman{},
+	"dnf":    Dnf{},
+	"apk":    Apk{},
+	"zypper": Zypper{},
+}
+
+// distros maps distribution ids, as found in the ID and ID_LIKE fields of /etc/os-release, to their package managers.
+var distros = map[string]string{
+	"debian":   "apt",
+	"ubuntu":   "apt",
+	"arch":     "pacman",
+	"fedora":   "dnf",
+	"rhel":     "dnf",
+	"centos":   "dnf",
+	"alpine":   "apk",
+	"suse":     "zypper",
+	"opensuse": "zypper",
+}
+
+// For returns the named manager.
+func For(name string) (Manager, error) {
+	m, ok := managers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown package manager %q", name)
+	}
+	return m, nil
+}
+
+// Detect returns the package manager of the running system: brew on macOS,
+// and otherwise that of the running distribution, per /etc/os-release.
+// Derivatives are matched by means of ID_LIKE, e.g. Linux Mint by way of ubuntu.
+func Detect() (Manager, error) {
+	if runtime.GOOS == "darwin" {
+		return Brew{}, nil
+	}
+	release, err := OSRelease()
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrUnsupported
+	}
+	if err != nil {
+		return nil, err
+	}
+	ids := append([]string{release["ID"]}, strings.Fields(release["ID_LIKE"])...)
+	for _, id := range ids {
+		// openSUSE's ids are suffixed by edition, e.g. opensuse-tumbleweed
+		id, _, _ = strings.Cut(id, "-")
+		if name, ok := distros[id]; ok {
+			return managers[name], nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnsupported, release["ID"])
+}
+
+// OSRelease returns the fields of /etc/os-release, with any quoting removed.
+func OSRelease() (map[string]string, error) {
+	b, err := os.ReadFile("/etc/os-release")
+	if err != nil {
+		return nil, fmt.Errorf("error reading /etc/os-release: %w", err)
+	}
+	fields := make(map[string]string)
+	for _, line := range strings.Split(string(b), "\n") {
+		if key, value, ok := strings.Cut(line, "="); ok {
+			fields[key] = strings.Trim(value, `"'`)
+		}
+	}
+	return fields, nil
+}
+
+// field returns the value of the first line of output of the form "key : value", as printed by `pacman -Si` and `zypper info`.
+func field(output, key string) string {
+	for _, line := range strings.Split(output, "\n") {
+		name, value, ok := strings.Cut(line, ":")
+		if ok && strings.TrimSpace(name) == key {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
+
+// privileged runs the command as root, streaming its output and including the tail of it in the returned error on failure.
+func privileged(ctx context.Context, args ...string) error {
+	return runCmd(ctx, privilege.Command(ctx, args[0], args[1:]...), args)
+}
+
+// run runs the command, streaming its output and including the tail of it in the returned error on failure.
+func run(ctx context.Context, args ...string) error {
+	return runCmd(ctx, exec.CommandContext(ctx, args[0], args[1:]...), args)
+}
+
+func runCmd(ctx context.Context, cmd *exec.Cmd, args []string) error {
+	if output, err := stream.Run(ctx, cmd); err != nil {
+		return fmt.Errorf("error running `%s`: %w\n%s", describe(args), err, string(output))
+	}
+	return nil
+}
+
+// query runs the command, returning its output.
+func query(ctx context.Context, args ...string) (string, error) {
+	output, err := exec.CommandContext(ctx, args[0], args[1:]...).Output()
+	if err != nil {
+		return "", fmt.Errorf("error running `%s`: %w", describe(args), err)
+	}
+	return string(output), nil
+}
+
+// describe abbreviates args to the command and its subcommand or first flag,
+// skipping any leading env assignments and an alternate --config.
+func describe(args []string) string {
+	if len(args) > 0 && args[0] == "env" {
+		args = args[1:]
+		for len(args) > 0 && strings.Contains(args[0], "=") {
+			args = args[1:]
+		}
+	}
+	if len(args) > 2 && args[1] == "--config" {
+		args = append([]string{args[0]}, args[3:]...)
+	}
+	return strings.Join(args[:min(len(args), 2)], " ")
+}
@@ -0,0 +1,62 @@
+package pkgmgr
+
+import (
+	"encoding/json"
+	"path"
+	"sort"
+)
+
+// Prune opts a stanza in to removing packages that were installed at the user's request but aren't declared.
+type Prune struct {
+	// Allow lists packages that are never pruned, despite not being declared.
+	Allow []string `json:"allow,omitempty"`
+}
+
+// Protector is implemented by managers that know of packages the system can't boot, update, or be reached without,
+// and which prune must therefore never remove.
+type Protector interface {
+	// Protected reports whether the named package is one that prune must never remove.
+	Protected(name string) bool
+}
+
+// Undeclared returns the sorted names among candidates that are neither declared, allowed, nor protected by m.
+func (p Prune) Undeclared(m Protector, candidates, declared []string) []string {
+	keep := make(map[string]bool)
+	for _, name := range declared {
+		keep[name] = true
+	}
+	for _, name := range p.Allow {
+		keep[name] = true
+	}
+	var undeclared []string
+	for _, name := range candidates {
+		if !keep[name] && !m.Protected(name) {
+			undeclared = append(undeclared, name)
+		}
+	}
+	sort.Strings(undeclared)
+	return undeclared
+}
+
+// patterns are package names, which may contain wildcards as understood by path.Match.
+type patterns []string
+
+// match reports whether name matches any of the patterns.
+func (ps patterns) match(name string) bool {
+	for _, pattern := range ps {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// BareList decodes b as a bare list of packages, reporting false if it's anything else.
+// Stanzas use it to accept a list of packages in place of the full stanza.
+func BareList[T any](b []byte) ([]T, bool) {
+	var pkgs []T
+	if err := json.Unmarshal(b, &pkgs); err != nil {
+		return nil, false
+	}
+	return pkgs, true
+}
@@ -0,0 +1,86 @@
+package pkgmgr
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestProtected(t *testing.T) {
+	tests := []struct {
+		manager Protector
+		name    string
+		want    bool
+	}{
+		{manager: Apt{}, name: "linux-image-6.8.0-45-generic", want: true},
+		{manager: Apt{}, name: "linux-generic-hwe-24.04", want: true},
+		{manager: Apt{}, name: "ubuntu-desktop", want: true},
+		{manager: Apt{}, name: "kubuntu-desktop", want: true},
+		{manager: Apt{}, name: "ubuntu-desktop-minimal", want: true},
+		{manager: Apt{}, name: "task-gnome-desktop", want: true},
+		{manager: Apt{}, name: "openssh-server", want: true},
+		{manager: Apt{}, name: "grub-efi-amd64-signed", want: true},
+		{manager: Apt{}, name: "intel-microcode", want: true},
+		{manager: Apt{}, name: "ripgrep", want: false},
+		{manager: Apt{}, name: "linux-tools-common", want: false},
+		{manager: Apt{}, name: "desktop-file-utils", want: false},
+
+		{manager: Pacman{}, name: "base", want: true},
+		{manager: Pacman{}, name: "linux-zen", want: true},
+		{manager: Pacman{}, name: "linux-firmware", want: true},
+		{manager: Pacman{}, name: "intel-ucode", want: true},
+		{manager: Pacman{}, name: "grub", want: true},
+		{manager: Pacman{}, name: "efibootmgr", want: true},
+		{manager: Pacman{}, name: "systemd-ukify", want: true},
+		{manager: Pacman{}, name: "mkinitcpio", want: true},
+		{manager: Pacman{}, name: "networkmanager", want: true},
+		{manager: Pacman{}, name: "iwd", want: true},
+		{manager: Pacman{}, name: "dhcpcd", want: true},
+		{manager: Pacman{}, name: "neovim", want: false},
+		{manager: Pacman{}, name: "linuxdoc-tools", want: false},
+
+		{manager: Dnf{}, name: "kernel", want: true},
+		{manager: Dnf{}, name: "kernel-core", want: true},
+		{manager: Dnf{}, name: "grub2-efi-x64", want: true},
+		{manager: Dnf{}, name: "shim-x64", want: true},
+		{manager: Dnf{}, name: "NetworkManager-wifi", want: true},
+		{manager: Dnf{}, name: "openssh-server", want: true},
+		{manager: Dnf{}, name: "fedora-release-common", want: true},
+		{manager: Dnf{}, name: "neovim", want: false},
+		{manager: Dnf{}, name: "kernelshark", want: false},
+		{manager: Dnf{}, name: "python3-dnf-plugins-xyz", want: false},
+
+		{manager: Apk{}, name: "busybox", want: true},
+		{manager: Apk{}, name: "alpine-base", want: true},
+		{manager: Apk{}, name: "busybox-extras", want: false},
+
+		{manager: Zypper{}, name: "kernel-default", want: true},
+		{manager: Zypper{}, name: "grub2-x86_64-efi", want: true},
+		{manager: Zypper{}, name: "patterns-base-minimal_base", want: true},
+		{manager: Zypper{}, name: "openSUSE-release", want: true},
+		{manager: Zypper{}, name: "wicked-service", want: true},
+		{manager: Zypper{}, name: "git-core", want: false},
+	}
+	for _, tt := range tests {
+		if got := tt.manager.Protected(tt.name); got != tt.want {
+			t.Errorf("%T.Protected(%q) = %t, want %t", tt.manager, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestUndeclared(t *testing.T) {
+	p := Prune{Allow: []string{"htop"}}
+	candidates := []string{"zsh", "linux-zen", "htop", "ripgrep", "base", "fd"}
+	got := p.Undeclared(Pacman{}, candidates, []string{"ripgrep"})
+	if want := []string{"fd", "zsh"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestBareList(t *testing.T) {
+	if got, ok := BareList[string]([]byte(`["ripgrep", "fd"]`)); !ok || !reflect.DeepEqual(got, []string{"ripgrep", "fd"}) {
+		t.Errorf("got %v, %t for a bare list", got, ok)
+	}
+	if _, ok := BareList[string]([]byte(`{"pkgs": ["ripgrep"]}`)); ok {
+		t.Error("got ok for a stanza")
+	}
+}
@@ -0,0 +1,164 @@
+package pkgmgr
+
+import (
+	"context"
+	"sort"
+	"strings"
+)
+
+// Dnf manages packages on Fedora, RHEL, and their derivatives.
+type Dnf struct{}
+
+func (Dnf) Name() string { return "dnf" }
+
+func (Dnf) Installed(ctx context.Context) (map[string]string, error) {
+	return rpmInstalled(ctx)
+}
+
+// UserInstalled returns the sorted names of packages installed at the user's request,
+// as reported by `dnf repoquery --userinstalled`.
+func (Dnf) UserInstalled(ctx context.Context) ([]string, error) {
+	output, err := query(ctx, "dnf", "repoquery", "--userinstalled", "--queryformat", "%{name}\n")
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	var names []string
+	for _, name := range strings.Fields(output) {
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (Dnf) Version(ctx context.Context, name string) (string, error) {
+	output, err := query(ctx, "dnf", "repoquery", "--latest-limit", "1", "--queryformat", "%{evr}\n", name)
+	if err != nil {
+		return "", err
+	}
+	// the latest version is listed once per available architecture, e.g. both x86_64 and i686
+	version, _, _ := strings.Cut(strings.TrimSpace(output), "\n")
+	return strings.TrimSpace(version), nil
+}
+
+func (Dnf) Install(ctx context.Context, names []string) error {
+	return privileged(ctx, append([]string{"dnf", "install", "-y"}, names...)...)
+}
+
+func (Dnf) Remove(ctx context.Context, names []string) error {
+	return privileged(ctx, append([]string{"dnf", "remove", "-y"}, names...)...)
+}
+
+func (Dnf) Refresh(ctx context.Context) error {
+	return privileged(ctx, "dnf", "makecache", "--refresh")
+}
+
+// dnfProtected match packages that are never pruned, as doing so would leave the system unable to boot, update, or be reached.
+// dnf itself refuses to remove only a few of these, such as the running kernel.
+var dnfProtected = patterns{
+	"kernel", "kernel-*", "linux-firmware", "*-firmware", "microcode_ctl",
+	"grub2-*", "shim-*", "efibootmgr", "systemd-boot*", "dracut", "dracut-*",
+	"dnf", "dnf5", "dnf-*", "rpm", "yum", "sudo", "systemd", "glibc", "basesystem", "setup", "filesystem", "bash", "passwd",
+	"fedora-release*", "redhat-release*", "centos-stream-release", "rocky-release", "almalinux-release",
+	"NetworkManager", "NetworkManager-*", "iwd", "dhcp-client", "openssh-server",
+}
+
+// Protected reports whether the named package is one that prune must never remove.
+func (Dnf) Protected(name string) bool { return dnfProtected.match(name) }
+
+// Zypper manages packages on openSUSE and SLES.
+type Zypper struct{}
+
+func (Zypper) Name() string { return "zypper" }
+
+func (Zypper) Installed(ctx context.Context) (map[string]string, error) {
+	return rpmInstalled(ctx)
+}
+
+// UserInstalled returns the sorted names of packages installed at the user's request,
+// as reported by `zypper packages --userinstalled`.
+func (Zypper) UserInstalled(ctx context.Context) ([]string, error) {
+	output, err := query(ctx, "zypper", "--non-interactive", "--quiet", "packages", "--userinstalled")
+	if err != nil {
+		return nil, err
+	}
+	return parseZypperPackages(output), nil
+}
+
+// parseZypperPackages returns the sorted names of the packages listed by `zypper packages`,
+// which it prints as a table of status, repository, name, version, and architecture.
+func parseZypperPackages(output string) []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Split(line, "|")
+		if len(fields) < 3 || strings.HasPrefix(strings.TrimSpace(line), "--") {
+			continue
+		}
+		// a package available from several repositories is listed once per repository
+		name := strings.TrimSpace(fields[2])
+		if name == "" || name == "Name" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (Zypper) Version(ctx context.Context, name string) (string, error) {
+	output, err := query(ctx, "zypper", "--non-interactive", "--quiet", "info", name)
+	if err != nil {
+		return "", err
+	}
+	return field(output, "Version"), nil
+}
+
+func (Zypper) Install(ctx context.Context, names []string) error {
+	return privileged(ctx, append([]string{"zypper", "--non-interactive", "install"}, names...)...)
+}
+
+// Remove removes names along with their no longer needed dependencies.
+func (Zypper) Remove(ctx context.Context, names []string) error {
+	return privileged(ctx, append([]string{"zypper", "--non-interactive", "remove", "--clean-deps"}, names...)...)
+}
+
+func (Zypper) Refresh(ctx context.Context) error {
+	return privileged(ctx, "zypper", "--non-interactive", "refresh")
+}
+
+// zypperProtected match packages that are never pruned, as doing so would leave the system unable to boot, update, or be reached.
+var zypperProtected = patterns{
+	"kernel-default", "kernel-*", "kernel-firmware*", "*-firmware", "ucode-*",
+	"grub2", "grub2-*", "shim", "efibootmgr", "dracut", "dracut-*",
+	"zypper", "libzypp", "rpm", "sudo", "systemd", "glibc", "bash", "filesystem", "aaa_base", "patterns-base-*",
+	"openSUSE-release*", "SLES-release*", "sles-release*",
+	"NetworkManager", "NetworkManager-*", "wicked", "wicked-*", "openssh", "openssh-server",
+}
+
+// Protected reports whether the named package is one that prune must never remove.
+func (Zypper) Protected(name string) bool { return zypperProtected.match(name) }
+
+// rpmInstalled returns the installed packages and their versions, as reported by `rpm -qa`.
+func rpmInstalled(ctx context.Context) (map[string]string, error) {
+	output, err := query(ctx, "rpm", "-qa", "--queryformat", "%{NAME}\t%{VERSION}-%{RELEASE}\n")
+	if err != nil {
+		return nil, err
+	}
+	return parseRPMInstalled(output), nil
+}
+
+// parseRPMInstalled parses the packages listed by `rpm -qa`, one per line as name and version separated by a tab.
+func parseRPMInstalled(output string) map[string]string {
+	installed := make(map[string]string)
+	for _, line := range strings.Split(output, "\n") {
+		if name, version, ok := strings.Cut(line, "\t"); ok {
+			installed[name] = version
+		}
+	}
+	return installed
+}
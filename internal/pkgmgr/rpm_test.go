@@ -0,0 +1,28 @@
+package pkgmgr
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseRPMInstalled(t *testing.T) {
+	output := "bash\t5.2.26-3.1\nvim\t9.1.0836-1.1\ngpg-pubkey\t3dbdc284-53674dd4\n\n"
+	want := map[string]string{"bash": "5.2.26-3.1", "vim": "9.1.0836-1.1", "gpg-pubkey": "3dbdc284-53674dd4"}
+	if got := parseRPMInstalled(output); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestParseZypperPackages(t *testing.T) {
+	output := `S  | Repository     | Name     | Version        | Arch
+---+----------------+----------+----------------+-------
+i+ | repo-oss       | vim      | 9.1.0836-1.1   | x86_64
+i+ | repo-oss       | git-core | 2.47.0-1.1     | x86_64
+i+ | repo-update    | git-core | 2.47.1-1.1     | x86_64
+i+ | @System        | htop     | 3.3.0-1.3      | x86_64
+`
+	want := []string{"git-core", "htop", "vim"}
+	if got := parseZypperPackages(output); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
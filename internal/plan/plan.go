@@ -0,0 +1,17 @@
+// Package plan carries whether a run should only report the changes it would make, rather than make them.
+package plan
+
+import "context"
+
+type contextKey struct{}
+
+// With returns a copy of ctx in which plan mode is enabled.
+func With(ctx context.Context) context.Context {
+	return context.WithValue(ctx, contextKey{}, true)
+}
+
+// Enabled reports whether plan mode is enabled for ctx.
+func Enabled(ctx context.Context) bool {
+	enabled, _ := ctx.Value(contextKey{}).(bool)
+	return enabled
+}
@@ -0,0 +1,6 @@
+package privilege
+
+// NewAsUser returns an Escalator as New does for a non-root user, regardless of the user running the tests.
+func NewAsUser(command string) *Escalator {
+	return newEscalator(command, false)
+}
@@ -0,0 +1,213 @@
+// Package privilege runs commands as root, by way of an escalation command such as sudo or doas unless already root.
+package privilege
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/danielmmetz/settle/internal/progress"
+)
+
+// keepaliveInterval is how often sudo's cached credentials are refreshed.
+// It's well within sudo's default timeout of five minutes.
+const keepaliveInterval = time.Minute
+
+// Escalator runs commands as root.
+type Escalator struct {
+	// prefix is the escalation command and its arguments, e.g. [sudo]. It's empty when already root.
+	prefix []string
+	// askpass reports whether sudo is to obtain the password by means of $SUDO_ASKPASS rather than from the terminal.
+	askpass bool
+	// command is the escalation command, even when already root, in which case it's used to run commands as another user.
+	command string
+
+	mu sync.Mutex
+	// primed is set once credentials have been obtained, or have failed to be, in which case primeErr is set.
+	primed   bool
+	primeErr error
+	// stop stops keeping sudo's cached credentials alive.
+	stop func()
+}
+
+// New returns an Escalator that runs commands by means of command, e.g. sudo or doas, which defaults to sudo.
+// If the current user is already root, commands are run directly.
+func New(command string) *Escalator {
+	return newEscalator(command, os.Geteuid() == 0)
+}
+
+func newEscalator(command string, root bool) *Escalator {
+	prefix := strings.Fields(command)
+	if len(prefix) == 0 {
+		prefix = []string{"sudo"}
+	}
+	if root {
+		return &Escalator{command: prefix[0]}
+	}
+	e := Escalator{prefix: prefix, command: prefix[0]}
+	if e.sudo() && os.Getenv("SUDO_ASKPASS") != "" {
+		e.askpass = true
+	}
+	return &e
+}
+
+func (e *Escalator) sudo() bool {
+	return len(e.prefix) > 0 && filepath.Base(e.prefix[0]) == "sudo"
+}
+
+// Command returns a command that runs name with args as root.
+// Credentials are obtained on the first such command, such that a run with nothing to do as root never escalates.
+// Should that fail, so does the returned command, with the reason why.
+func (e *Escalator) Command(ctx context.Context, name string, args ...string) *exec.Cmd {
+	if len(e.prefix) == 0 {
+		return exec.CommandContext(ctx, name, args...)
+	}
+	primeErr := e.Prime(ctx)
+	cmdArgs := append([]string{}, e.prefix[1:]...)
+	if e.sudo() {
+		// Output is captured, so prompting for a password would leave the run hanging on a prompt no one sees.
+		// Credentials are instead primed up front, or obtained by means of askpass.
+		if e.askpass {
+			cmdArgs = append(cmdArgs, "-A")
+		} else {
+			cmdArgs = append(cmdArgs, "-n")
+		}
+	}
+	cmdArgs = append(append(cmdArgs, name), args...)
+	cmd := exec.CommandContext(ctx, e.prefix[0], cmdArgs...)
+	if primeErr != nil {
+		cmd.Err = primeErr
+	}
+	return cmd
+}
+
+// Args returns the escalation command and the flags with which it runs commands as root without prompting, e.g. [sudo -n],
+// for tools that escalate by themselves, such as AUR helpers. That's the case even when already root,
+// as such tools run as an unprivileged user.
+func (e *Escalator) Args() []string {
+	args := e.prefix
+	if len(args) == 0 {
+		args = []string{e.command}
+	}
+	args = append([]string{}, args...)
+	if filepath.Base(args[0]) == "sudo" {
+		if e.askpass {
+			args = append(args, "-A")
+		} else {
+			args = append(args, "-n")
+		}
+	}
+	return args
+}
+
+// UserCommand returns a command that runs name with args as user, by way of the escalation command.
+// It's for dropping root privileges, such as to build packages that refuse to be built as root.
+func (e *Escalator) UserCommand(ctx context.Context, user, name string, args ...string) *exec.Cmd {
+	var cmdArgs []string
+	switch filepath.Base(e.command) {
+	case "doas":
+		cmdArgs = []string{"-u", user, name}
+	case "run0":
+		cmdArgs = []string{"--user=" + user, name}
+	default:
+		cmdArgs = []string{"-u", user, "--", name}
+	}
+	return exec.CommandContext(ctx, e.command, append(cmdArgs, args...)...)
+}
+
+// Prime obtains credentials, prompting on the terminal if need be, such that later commands needn't prompt.
+// It does so only once, on the first call; Command calls it, as should anything that escalates by itself.
+// For sudo, the cached credentials are then kept alive until Release is called.
+func (e *Escalator) Prime(ctx context.Context) error {
+	if len(e.prefix) == 0 {
+		return nil
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.primed {
+		return e.primeErr
+	}
+	e.primed = true
+
+	args := append([]string{}, e.prefix[1:]...)
+	if e.sudo() {
+		if e.askpass {
+			args = append(args, "-A")
+		}
+		args = append(args, "-v")
+	} else {
+		args = append(args, "true")
+	}
+	// the prompt, if any, needs the terminal
+	progress.Suspend(ctx)
+	defer progress.Resume(ctx)
+	fmt.Printf("obtaining root privileges with `%s`\n", e.prefix[0])
+	primeCmd := exec.CommandContext(ctx, e.prefix[0], args...)
+	primeCmd.Stdin, primeCmd.Stdout, primeCmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := primeCmd.Run(); err != nil {
+		e.primeErr = fmt.Errorf("error obtaining root privileges with `%s`: %w", e.prefix[0], err)
+		return e.primeErr
+	}
+	if !e.sudo() {
+		return nil
+	}
+
+	// the keepalive outlives the stanza that happened to prime, so isn't bound to its context
+	keepaliveCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(keepaliveInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-keepaliveCtx.Done():
+				return
+			case <-ticker.C:
+				// failures are left to surface from whichever command next needs the credentials
+				keepaliveArgs := append(append([]string{}, e.prefix[1:]...), "-n", "-v")
+				_ = exec.CommandContext(keepaliveCtx, e.prefix[0], keepaliveArgs...).Run()
+			}
+		}
+	}()
+	e.stop = func() {
+		cancel()
+		<-done
+	}
+	return nil
+}
+
+// Release stops keeping cached credentials alive, if they were obtained.
+func (e *Escalator) Release() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.stop != nil {
+		e.stop()
+		e.stop = nil
+	}
+}
+
+type contextKey struct{}
+
+// With returns a copy of ctx carrying e.
+func With(ctx context.Context, e *Escalator) context.Context {
+	return context.WithValue(ctx, contextKey{}, e)
+}
+
+// From returns the Escalator carried by ctx, or the default one if there is none.
+func From(ctx context.Context) *Escalator {
+	if e, ok := ctx.Value(contextKey{}).(*Escalator); ok {
+		return e
+	}
+	return New("")
+}
+
+// Command returns a command that runs name with args as root, by way of the Escalator carried by ctx.
+func Command(ctx context.Context, name string, args ...string) *exec.Cmd {
+	return From(ctx).Command(ctx, name, args...)
+}
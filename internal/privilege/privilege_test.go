@@ -0,0 +1,78 @@
+package privilege_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/danielmmetz/settle/internal/config"
+	"github.com/danielmmetz/settle/internal/packages"
+	"github.com/danielmmetz/settle/internal/privilege"
+)
+
+// fakeEscalator installs an escalation command that records its arguments and runs nothing,
+// along with a fake pacman that reports ripgrep as installed, returning the path of the record.
+func fakeEscalator(t *testing.T) (string, string) {
+	t.Helper()
+	dir := t.TempDir()
+	record := filepath.Join(dir, "calls")
+	scripts := map[string]string{
+		"fake-sudo": "#!/bin/sh\necho \"$@\" >> " + record + "\n",
+		"pacman":    "#!/bin/sh\n[ \"$1\" = -Q ] && echo 'ripgrep 14.1.0-1'\nexit 0\n",
+	}
+	for name, script := range scripts {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(script), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return filepath.Join(dir, "fake-sudo"), record
+}
+
+func calls(t *testing.T, record string) []string {
+	t.Helper()
+	b, err := os.ReadFile(record)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSpace(string(b)), "\n")
+}
+
+func TestNoOpRunDoesNotEscalate(t *testing.T) {
+	command, record := fakeEscalator(t)
+	e := privilege.NewAsUser(command)
+	defer e.Release()
+	ctx := privilege.With(context.Background(), e)
+
+	c := config.Config{Packages: &packages.Packages{Manager: "pacman", Pkgs: []packages.Pkg{{Name: "ripgrep"}}}}
+	if err := c.Ensure(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := calls(t, record); len(got) != 0 {
+		t.Fatalf("expected no escalation, got %q", got)
+	}
+}
+
+func TestEscalatesOnFirstUse(t *testing.T) {
+	command, record := fakeEscalator(t)
+	e := privilege.NewAsUser(command)
+	defer e.Release()
+	ctx := privilege.With(context.Background(), e)
+
+	c := config.Config{Packages: &packages.Packages{Manager: "pacman", Pkgs: []packages.Pkg{{Name: "ripgrep"}, {Name: "fd"}}}}
+	if err := c.Ensure(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := privilege.Command(ctx, "true", "fd").Run(); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"true", "pacman -S --needed --noconfirm fd", "true fd"}
+	got := calls(t, record)
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("expected credentials to be obtained once, then each command escalated: got %q, want %q", got, want)
+	}
+}
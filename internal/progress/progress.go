@@ -0,0 +1,310 @@
+// Package progress renders a live view of a run on interactive terminals:
+// each module, its current step, and how long it has been running, followed by a summary once the run ends.
+package progress
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	refreshInterval = 100 * time.Millisecond
+	defaultWidth    = 80
+	// control prefixes lines written by Begin and End, which travel through stdout alongside the output they delimit
+	// such that each line of output is attributed to the module that wrote it.
+	control = "\x00settle-progress "
+)
+
+var spinner = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+type state int
+
+const (
+	pending state = iota
+	running
+	succeeded
+	failed
+)
+
+type module struct {
+	name     string
+	state    state
+	step     string
+	started  time.Time
+	finished time.Time
+}
+
+func (m *module) elapsed(now time.Time) time.Duration {
+	switch m.state {
+	case running:
+		return now.Sub(m.started)
+	case succeeded, failed:
+		return m.finished.Sub(m.started)
+	}
+	return 0
+}
+
+// View renders the progress of a run in place of the lines written to stdout, which it takes over until stopped.
+type View struct {
+	term   *os.File
+	w      *os.File
+	start  time.Time
+	stop   chan struct{}
+	done   sync.WaitGroup
+	mu     sync.Mutex
+	mods   []*module
+	frame  int
+	height int
+	// suspended is set while an interactive step has the terminal, during which the View isn't rendered
+	suspended bool
+	// trailing are lines written while no module was running, which are printed following the summary
+	trailing []string
+}
+
+// Interactive reports whether stdout is a terminal capable of rendering a View.
+func Interactive() bool {
+	if os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	fi, err := os.Stdout.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// Start takes over stdout and begins rendering a View of the named modules.
+func Start(modules []string) (*View, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, fmt.Errorf("error creating pipe for progress view: %w", err)
+	}
+	v := View{term: os.Stdout, w: w, start: time.Now(), stop: make(chan struct{})}
+	for _, name := range modules {
+		v.mods = append(v.mods, &module{name: name})
+	}
+	os.Stdout = w
+
+	v.done.Add(2)
+	go func() {
+		defer v.done.Done()
+		defer r.Close()
+		v.read(r)
+	}()
+	go func() {
+		defer v.done.Done()
+		ticker := time.NewTicker(refreshInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-v.stop:
+				return
+			case <-ticker.C:
+				v.mu.Lock()
+				if !v.suspended {
+					v.frame++
+					v.render(false)
+				}
+				v.mu.Unlock()
+			}
+		}
+	}()
+	return &v, nil
+}
+
+// Stop restores stdout and replaces the View with a summary of the run.
+func (v *View) Stop() {
+	os.Stdout = v.term
+	_ = v.w.Close()
+	close(v.stop)
+	v.done.Wait()
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.render(true)
+	var ok, bad, skipped int
+	for _, m := range v.mods {
+		switch m.state {
+		case succeeded:
+			ok++
+		case failed:
+			bad++
+		default:
+			skipped++
+		}
+	}
+	summary := fmt.Sprintf("%d succeeded", ok)
+	if bad > 0 {
+		summary += fmt.Sprintf(", %d failed", bad)
+	}
+	if skipped > 0 {
+		summary += fmt.Sprintf(", %d skipped", skipped)
+	}
+	fmt.Fprintf(v.term, "finished in %s: %s\n", round(time.Since(v.start)), summary)
+	for _, line := range v.trailing {
+		fmt.Fprintln(v.term, line)
+	}
+}
+
+func (v *View) read(r *os.File) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		v.mu.Lock()
+		if rest, ok := strings.CutPrefix(line, control); ok {
+			v.apply(rest)
+		} else if m := v.current(); m != nil {
+			if step := strings.TrimSpace(strings.TrimPrefix(line, "["+m.name+"]")); step != "" {
+				m.step = step
+			}
+		} else {
+			v.trailing = append(v.trailing, line)
+		}
+		v.mu.Unlock()
+	}
+}
+
+// apply applies a control line of the form "begin <module>" or "end <module> <succeeded|failed>".
+func (v *View) apply(line string) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		return
+	}
+	m := v.module(fields[1])
+	switch fields[0] {
+	case "begin":
+		m.state, m.started = running, time.Now()
+	case "end":
+		m.state, m.finished = succeeded, time.Now()
+		if len(fields) > 2 && fields[2] == "failed" {
+			m.state = failed
+		}
+	}
+}
+
+func (v *View) module(name string) *module {
+	for _, m := range v.mods {
+		if m.name == name {
+			return m
+		}
+	}
+	m := &module{name: name}
+	v.mods = append(v.mods, m)
+	return m
+}
+
+func (v *View) current() *module {
+	for _, m := range v.mods {
+		if m.state == running {
+			return m
+		}
+	}
+	return nil
+}
+
+// render redraws the View over its previous rendering. In the final rendering, steps are shown only for failed modules.
+func (v *View) render(final bool) {
+	cols := width(v.term)
+	if cols <= 0 {
+		cols = defaultWidth
+	}
+	namePad := 0
+	for _, m := range v.mods {
+		namePad = max(namePad, len(m.name))
+	}
+
+	var sb strings.Builder
+	if v.height > 0 {
+		fmt.Fprintf(&sb, "\x1b[%dA", v.height)
+	}
+	now := time.Now()
+	for _, m := range v.mods {
+		var icon, elapsed, step string
+		switch m.state {
+		case pending:
+			icon = "·"
+			if final {
+				elapsed = "skipped"
+			}
+		case running:
+			icon, elapsed, step = spinner[v.frame%len(spinner)], round(m.elapsed(now)), m.step
+		case succeeded:
+			icon, elapsed = "✓", round(m.elapsed(now))
+			if !final {
+				step = m.step
+			}
+		case failed:
+			icon, elapsed, step = "✗", round(m.elapsed(now)), m.step
+		}
+		line := fmt.Sprintf("%s %-*s %7s  %s", icon, namePad, m.name, elapsed, step)
+		sb.WriteString("\r\x1b[2K" + truncate(strings.TrimRight(line, " "), cols-1) + "\n")
+	}
+	v.height = len(v.mods)
+	fmt.Fprint(v.term, sb.String())
+}
+
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	runes := []rune(s)
+	return string(runes[:max(n-1, 0)]) + "…"
+}
+
+func round(d time.Duration) string {
+	if d < time.Minute {
+		return d.Round(100 * time.Millisecond).String()
+	}
+	return d.Round(time.Second).String()
+}
+
+type contextKey struct{}
+
+// With returns a copy of ctx carrying v.
+func With(ctx context.Context, v *View) context.Context {
+	return context.WithValue(ctx, contextKey{}, v)
+}
+
+// Begin marks the module as running within the View carried by ctx, if any.
+func Begin(ctx context.Context, module string) {
+	if v, ok := ctx.Value(contextKey{}).(*View); ok {
+		fmt.Fprintf(v.w, "%sbegin %s\n", control, module)
+	}
+}
+
+// End marks the module as having finished within the View carried by ctx, if any.
+func End(ctx context.Context, module string, err error) {
+	if v, ok := ctx.Value(contextKey{}).(*View); ok {
+		result := "succeeded"
+		if err != nil {
+			result = "failed"
+		}
+		fmt.Fprintf(v.w, "%send %s %s\n", control, module, result)
+	}
+}
+
+// Suspend hands stdout back to the terminal for an interactive step, such as a prompt or a command that reads from stdin,
+// pausing the View carried by ctx, if any, until Resume is called.
+func Suspend(ctx context.Context) {
+	if v, ok := ctx.Value(contextKey{}).(*View); ok {
+		v.mu.Lock()
+		defer v.mu.Unlock()
+		v.suspended = true
+		os.Stdout = v.term
+	}
+}
+
+// Resume takes stdout back over and resumes rendering the View carried by ctx, if any, below whatever the interactive step wrote.
+func Resume(ctx context.Context) {
+	if v, ok := ctx.Value(contextKey{}).(*View); ok {
+		v.mu.Lock()
+		defer v.mu.Unlock()
+		v.suspended = false
+		v.height = 0
+		os.Stdout = v.w
+	}
+}
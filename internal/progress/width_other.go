@@ -0,0 +1,8 @@
+//go:build !(linux || darwin)
+
+package progress
+
+import "os"
+
+// width is unknown on platforms without TIOCGWINSZ, in which case the default is used.
+func width(f *os.File) int { return 0 }
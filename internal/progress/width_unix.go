@@ -0,0 +1,19 @@
+//go:build linux || darwin
+
+package progress
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// width returns the width of the terminal f, or 0 if it can't be determined.
+func width(f *os.File) int {
+	var ws struct{ row, col, xpixel, ypixel uint16 }
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), uintptr(syscall.TIOCGWINSZ), uintptr(unsafe.Pointer(&ws)))
+	if errno != 0 {
+		return 0
+	}
+	return int(ws.col)
+}
@@ -0,0 +1,173 @@
+// Package stream runs subprocesses, streaming their output live, prefixed by the module that ran them,
+// and recording it in full to the run's log file.
+package stream
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tailLines is the number of trailing lines of output retained for error messages.
+const tailLines = 20
+
+// Log is the log file of a single run.
+type Log struct {
+	mu   sync.Mutex
+	f    *os.File
+	path string
+}
+
+// keepLogs is the number of runs whose logs are kept.
+const keepLogs = 20
+
+// CreateLog creates a log file for the run under ~/.local/share/settle/logs, readable only by the current user,
+// and removes all but the most recent logs.
+// Logs are named for the time of the run, in UTC, and the pid of the process, e.g. 20240102T150405Z-1234.log.
+func CreateLog() (*Log, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("unable to determine home dir: %w", err)
+	}
+	dir := filepath.Join(home, ".local", "share", "settle", "logs")
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("error creating %s: %w", dir, err)
+	}
+	// logs record the output of every command run, so the directory is private, even if it predates this
+	if err := os.Chmod(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("error setting permissions of %s: %w", dir, err)
+	}
+	name := fmt.Sprintf("%s-%d.log", time.Now().UTC().Format("20060102T150405Z"), os.Getpid())
+	path := filepath.Join(dir, name)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("error creating log file: %w", err)
+	}
+	pruneLogs(dir, keepLogs)
+	return &Log{f: f, path: path}, nil
+}
+
+// pruneLogs removes all but the keep most recent logs within dir. It's best effort: failures are ignored.
+func pruneLogs(dir string, keep int) {
+	logs, err := filepath.Glob(filepath.Join(dir, "*.log"))
+	if err != nil || len(logs) <= keep {
+		return
+	}
+	// names begin with the time of the run, so sort chronologically
+	sort.Strings(logs)
+	for _, path := range logs[:len(logs)-keep] {
+		_ = os.Remove(path)
+	}
+}
+
+// Path returns the path of the log file.
+func (l *Log) Path() string { return l.path }
+
+func (l *Log) Close() error { return l.f.Close() }
+
+func (l *Log) println(line string) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	fmt.Fprintf(l.f, "%s %s\n", time.Now().Format("15:04:05"), line)
+}
+
+type logKey struct{}
+
+type moduleKey struct{}
+
+// WithLog returns a copy of ctx in which output is recorded to l.
+func WithLog(ctx context.Context, l *Log) context.Context {
+	return context.WithValue(ctx, logKey{}, l)
+}
+
+// With returns a copy of ctx in which output is attributed to the named module, e.g. apt.
+func With(ctx context.Context, module string) context.Context {
+	return context.WithValue(ctx, moduleKey{}, module)
+}
+
+// Module returns the module to which output is attributed within ctx, if any.
+func Module(ctx context.Context) string {
+	module, _ := ctx.Value(moduleKey{}).(string)
+	return module
+}
+
+// Run runs cmd, streaming its combined stdout and stderr line by line, prefixed by the module of ctx.
+// It returns the last lines of output, for inclusion in error messages.
+func Run(ctx context.Context, cmd *exec.Cmd) ([]byte, error) {
+	l, _ := ctx.Value(logKey{}).(*Log)
+	prefix := ""
+	if module := Module(ctx); module != "" {
+		prefix = "[" + module + "] "
+	}
+	l.println(prefix + "$ " + strings.Join(cmd.Args, " "))
+
+	w := &lineWriter{out: os.Stdout, prefix: prefix, log: l}
+	cmd.Stdout, cmd.Stderr = w, w
+	err := cmd.Run()
+	w.flush()
+	if err != nil {
+		l.println(prefix + err.Error())
+	}
+	return w.tail(), err
+}
+
+// lineWriter writes each complete line to out and the log, retaining the last tailLines lines.
+type lineWriter struct {
+	out    io.Writer
+	prefix string
+	log    *Log
+	buf    []byte
+	lines  []string
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i == -1 {
+			break
+		}
+		w.line(string(w.buf[:i]))
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+func (w *lineWriter) flush() {
+	if len(w.buf) > 0 {
+		w.line(string(w.buf))
+		w.buf = nil
+	}
+}
+
+func (w *lineWriter) line(line string) {
+	// progress indicators redraw the line by means of carriage returns, of which only the final state is kept
+	if i := strings.LastIndexByte(strings.TrimRight(line, "\r"), '\r'); i != -1 {
+		line = line[i+1:]
+	}
+	line = strings.TrimRight(line, "\r")
+	fmt.Fprintln(w.out, strings.TrimRight(w.prefix+line, " "))
+	w.log.println(w.prefix + line)
+	w.lines = append(w.lines, line)
+	if len(w.lines) > tailLines {
+		w.lines = w.lines[1:]
+	}
+}
+
+func (w *lineWriter) tail() []byte {
+	if len(w.lines) == 0 {
+		return nil
+	}
+	return []byte(strings.Join(w.lines, "\n") + "\n")
+}
@@ -0,0 +1,53 @@
+package stream
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestPruneLogs(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{
+		"2024-01-01 09:00:00.log", // named before logs were named in RFC 3339 basic format
+		"20240102T150405Z-100.log",
+		"20240103T150405Z-200.log",
+		"20240103T160405Z-300.log",
+		"notes.txt",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pruneLogs(dir, 2)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, e := range entries {
+		got = append(got, e.Name())
+	}
+	want := []string{"20240103T150405Z-200.log", "20240103T160405Z-300.log", "notes.txt"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestCreateLog(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	l, err := CreateLog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	info, err := os.Stat(l.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Fatalf("expected mode 0600, got %o", perm)
+	}
+}
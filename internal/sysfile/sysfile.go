@@ -0,0 +1,81 @@
+// Package sysfile writes system files, such as those under /etc, that are typically owned by root.
+package sysfile
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/danielmmetz/settle/internal/atomicfile"
+	"github.com/danielmmetz/settle/internal/plan"
+	"github.com/danielmmetz/settle/internal/privilege"
+	"github.com/danielmmetz/settle/internal/stream"
+)
+
+// WriteFile writes contents to path with mode 0644, unless it already has those contents.
+// The file is written directly if the current user is permitted to, and as root otherwise.
+// It reports whether the file was (or, in plan mode, would be) written.
+func WriteFile(ctx context.Context, path string, contents []byte) (bool, error) {
+	if existing, err := os.ReadFile(path); err == nil && bytes.Equal(existing, contents) {
+		return false, nil
+	}
+	if plan.Enabled(ctx) {
+		fmt.Println("would write", path)
+		return true, nil
+	}
+
+	fmt.Println("writing", path)
+	err := atomicfile.WriteFile(path, contents, 0o644)
+	if err == nil {
+		return true, nil
+	}
+	if !errors.Is(err, os.ErrPermission) && !errors.Is(err, os.ErrNotExist) {
+		return false, err
+	}
+
+	f, err := os.CreateTemp("", "")
+	if err != nil {
+		return false, fmt.Errorf("error creating temporary file for %s: %w", path, err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	if _, err := f.Write(contents); err != nil {
+		return false, fmt.Errorf("error writing temporary file for %s: %w", path, err)
+	}
+	if err := f.Close(); err != nil {
+		return false, fmt.Errorf("error writing temporary file for %s: %w", path, err)
+	}
+	installCmd := privilege.Command(ctx, "install", "-D", "-m", "0644", f.Name(), path)
+	if output, err := stream.Run(ctx, installCmd); err != nil {
+		return false, fmt.Errorf("error running `install` for %s: %w\n%s", path, err, string(output))
+	}
+	return true, nil
+}
+
+// Remove removes path, if it exists, directly if the current user is permitted to, and as root otherwise.
+// It reports whether the file was (or, in plan mode, would be) removed.
+func Remove(ctx context.Context, path string) (bool, error) {
+	if _, err := os.Lstat(path); errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if plan.Enabled(ctx) {
+		fmt.Println("would remove", path)
+		return true, nil
+	}
+
+	fmt.Println("removing", path)
+	err := os.Remove(path)
+	if err == nil || errors.Is(err, os.ErrNotExist) {
+		return true, nil
+	}
+	if !errors.Is(err, os.ErrPermission) {
+		return false, err
+	}
+	removeCmd := privilege.Command(ctx, "rm", "-f", path)
+	if output, err := stream.Run(ctx, removeCmd); err != nil {
+		return false, fmt.Errorf("error running `rm` for %s: %w\n%s", path, err, string(output))
+	}
+	return true, nil
+}
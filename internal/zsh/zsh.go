@@ -8,23 +8,41 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/danielmmetz/settle/internal/journal"
+	"github.com/danielmmetz/settle/internal/plan"
 	"golang.org/x/exp/slices"
 )
 
 type Zsh struct {
-	History struct {
-		Size          int  `json:"size"`
-		ShareHistory  bool `json:"share_history"`
-		IncAppend     bool `json:"inc_append"`
-		IgnoreAllDups bool `json:"ignore_all_dups"`
-		IgnoreSpace   bool `json:"ignore_space"`
-	} `json:"history"`
-	Paths     []string `json:"paths"`
-	Variables []KV     `json:"variables"`
-	Aliases   []KV     `json:"aliases"`
-	Functions []KV     `json:"functions"`
-	Prefix    string   `json:"prefix"`
-	Suffix    string   `json:"suffix"`
+	History   *History `json:"history,omitempty"`
+	Paths     []string `json:"paths,omitempty"`
+	Variables []KV     `json:"variables,omitempty"`
+	Aliases   []KV     `json:"aliases,omitempty"`
+	Functions []KV     `json:"functions,omitempty"`
+	Prefix    string   `json:"prefix,omitempty"`
+	Suffix    string   `json:"suffix,omitempty"`
+
+	// shellEnv are lines, such as `eval "$(brew shellenv)"`, that set up the environment of tools settle installs.
+	shellEnv []string
+}
+
+// WithShellEnv returns a copy of z that additionally evaluates line ahead of its paths and variables,
+// unless the prefix or suffix already mention the command it evaluates.
+func (z *Zsh) WithShellEnv(line, command string) *Zsh {
+	if strings.Contains(z.Prefix, command) || strings.Contains(z.Suffix, command) {
+		return z
+	}
+	merged := *z
+	merged.shellEnv = append(append([]string(nil), z.shellEnv...), line)
+	return &merged
+}
+
+type History struct {
+	Size          int  `json:"size,omitempty"`
+	ShareHistory  bool `json:"share_history,omitempty"`
+	IncAppend     bool `json:"inc_append,omitempty"`
+	IgnoreAllDups bool `json:"ignore_all_dups,omitempty"`
+	IgnoreSpace   bool `json:"ignore_space,omitempty"`
 }
 
 type KV struct {
@@ -41,8 +59,17 @@ func (z *Zsh) Ensure(ctx context.Context) error {
 	if err != nil {
 		return fmt.Errorf("unable to determine home dir: %w", err)
 	}
+	path := filepath.Join(home, ".zshrc")
+	if plan.Enabled(ctx) {
+		if existing, err := os.ReadFile(path); err == nil && string(existing) == z.String() {
+			fmt.Println(".zshrc is up to date")
+		} else {
+			fmt.Println("would write .zshrc")
+		}
+		return nil
+	}
 	fmt.Println("writing .zshrc")
-	if err := os.WriteFile(filepath.Join(home, ".zshrc"), []byte(z.String()), 0o644); err != nil {
+	if err := journal.WriteFile(ctx, path, []byte(z.String()), 0o644); err != nil {
 		return fmt.Errorf("error writing .zshrc: %w", err)
 	}
 	return nil
@@ -56,25 +83,32 @@ func (z *Zsh) String() string {
 	sb.WriteString("\n")
 
 	// history
-	if z.History.Size != 0 {
-		sb.WriteString("HISTFILE=~/.zsh_history\n")
-		sb.WriteString(fmt.Sprintf("HISTSIZE=%d\n", z.History.Size))
-		sb.WriteString(fmt.Sprintf("SAVEHIST=%d\n", z.History.Size))
-	}
-	if z.History.ShareHistory {
-		sb.WriteString("setopt SHARE_HISTORY\n")
-	}
-	if z.History.IncAppend {
-		sb.WriteString("setopt INC_APPEND_HISTORY\n")
-	}
-	if z.History.IgnoreAllDups {
-		sb.WriteString("setopt HIST_IGNORE_ALL_DUPS\n")
-	}
-	if z.History.IgnoreSpace {
-		sb.WriteString("setopt HIST_IGNORE_SPACE\n")
+	if h := z.History; h != nil {
+		if h.Size != 0 {
+			sb.WriteString("HISTFILE=~/.zsh_history\n")
+			sb.WriteString(fmt.Sprintf("HISTSIZE=%d\n", h.Size))
+			sb.WriteString(fmt.Sprintf("SAVEHIST=%d\n", h.Size))
+		}
+		if h.ShareHistory {
+			sb.WriteString("setopt SHARE_HISTORY\n")
+		}
+		if h.IncAppend {
+			sb.WriteString("setopt INC_APPEND_HISTORY\n")
+		}
+		if h.IgnoreAllDups {
+			sb.WriteString("setopt HIST_IGNORE_ALL_DUPS\n")
+		}
+		if h.IgnoreSpace {
+			sb.WriteString("setopt HIST_IGNORE_SPACE\n")
+		}
 	}
 	sb.WriteString("\n")
 
+	// environment of installed tools, which paths and variables may build upon
+	for _, line := range z.shellEnv {
+		sb.WriteString(line + "\n")
+	}
+
 	// path
 	if len(z.Paths) > 0 {
 		if !slices.Contains(z.Paths, "$PATH") {
@@ -110,3 +144,204 @@ func (z *Zsh) String() string {
 	sb.WriteString("\n")
 	return sb.String()
 }
+
+// section is where a line of an existing .zshrc ends up once parsed, in the order that String writes them.
+type section int
+
+const (
+	blank section = iota
+	history
+	paths
+	variables
+	aliases
+	// verbatim lines can't be parsed without changing their meaning, so they're kept in place within Prefix or Suffix.
+	verbatim
+)
+
+// Parse builds a Zsh from the contents of an existing .zshrc.
+// Recognized history settings, PATH exports, variables, and aliases are parsed into their respective fields.
+// Everything else, including comments and multi-line constructs, is preserved verbatim in Prefix or Suffix.
+// Only lines that keep their meaning once rewritten by String are parsed: those within the longest span
+// free of verbatim lines in which PATH exports, variables, and aliases already appear in that order.
+func Parse(rc string) *Zsh {
+	lines := strings.Split(rc, "\n")
+	sections := make([]section, len(lines))
+	var scratch Zsh
+	depth := 0
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case depth > 0 || strings.HasPrefix(trimmed, "#"):
+			sections[i] = verbatim
+		case trimmed == "":
+			sections[i] = blank
+		default:
+			s, ok := scratch.parseLine(trimmed)
+			if !ok {
+				s = verbatim
+			}
+			sections[i] = s
+		}
+		depth += strings.Count(trimmed, "{") - strings.Count(trimmed, "}")
+		if depth < 0 {
+			depth = 0
+		}
+	}
+
+	var z Zsh
+	start, end := span(sections)
+	for _, line := range lines[start:end] {
+		if trimmed := strings.TrimSpace(line); trimmed != "" {
+			z.parseLine(trimmed)
+		}
+	}
+	z.Prefix = strings.TrimSpace(strings.Join(lines[:start], "\n"))
+	z.Suffix = strings.TrimSpace(strings.Join(lines[end:], "\n"))
+	return &z
+}
+
+// span returns the bounds of the lines to parse: the span with the most parseable lines
+// that contains no verbatim lines and in which PATH exports, variables, and aliases appear in the order String writes them.
+// History settings are independent of the rest, so they may appear anywhere.
+func span(sections []section) (int, int) {
+	var bestStart, bestEnd, best int
+	for start := range sections {
+		latest, count, end := blank, 0, start
+		for ; end < len(sections); end++ {
+			s := sections[end]
+			if s == verbatim || (s >= paths && s < latest) {
+				break
+			}
+			if s >= paths {
+				latest = s
+			}
+			if s != blank {
+				count++
+			}
+		}
+		if count > best {
+			bestStart, bestEnd, best = start, end, count
+		}
+	}
+	return bestStart, bestEnd
+}
+
+// history returns z's history settings, allocating them if need be.
+func (z *Zsh) history() *History {
+	if z.History == nil {
+		z.History = &History{}
+	}
+	return z.History
+}
+
+// parseLine parses a single top-level .zshrc line into z, reporting the section it was parsed into and whether it was recognized.
+func (z *Zsh) parseLine(line string) (section, bool) {
+	if strings.ContainsAny(line, ";{}") {
+		return verbatim, false
+	}
+	if name, ok := strings.CutPrefix(line, "setopt "); ok {
+		switch strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(name), "_", "")) {
+		case "SHAREHISTORY":
+			z.history().ShareHistory = true
+		case "INCAPPENDHISTORY":
+			z.history().IncAppend = true
+		case "HISTIGNOREALLDUPS":
+			z.history().IgnoreAllDups = true
+		case "HISTIGNORESPACE":
+			z.history().IgnoreSpace = true
+		default:
+			return verbatim, false
+		}
+		return history, true
+	}
+	if rest, ok := strings.CutPrefix(line, "alias "); ok {
+		name, value, ok := strings.Cut(rest, "=")
+		if !ok || strings.HasPrefix(name, "-") {
+			return verbatim, false
+		}
+		value, ok = aliasValue(value)
+		if !ok {
+			return verbatim, false
+		}
+		z.Aliases = append(z.Aliases, KV{Name: name, Value: value})
+		return aliases, true
+	}
+
+	assignment, exported := strings.CutPrefix(line, "export ")
+	name, value, ok := strings.Cut(assignment, "=")
+	if !ok || strings.ContainsAny(name, " \t") {
+		return verbatim, false
+	}
+	switch name {
+	case "HISTFILE":
+		if unquote(value) != "~/.zsh_history" {
+			return verbatim, false
+		}
+		return history, true
+	case "SAVEHIST":
+		return history, true
+	case "HISTSIZE":
+		size, err := strconv.Atoi(unquote(value))
+		if err != nil {
+			return verbatim, false
+		}
+		z.history().Size = size
+		return history, true
+	case "PATH":
+		// each export builds upon the PATH so far, which takes the place of its $PATH
+		var updated []string
+		seenPath := false
+		for _, p := range strings.Split(unquote(value), ":") {
+			if p != "$PATH" && p != "${PATH}" {
+				updated = append(updated, p)
+				continue
+			}
+			if seenPath {
+				continue
+			}
+			seenPath = true
+			if len(z.Paths) > 0 {
+				updated = append(updated, z.Paths...)
+			} else {
+				updated = append(updated, "$PATH")
+			}
+		}
+		z.Paths = updated
+		return paths, true
+	}
+	if !exported {
+		return verbatim, false
+	}
+	z.Variables = append(z.Variables, KV{Name: name, Value: value})
+	return variables, true
+}
+
+// aliasValue returns the value of an alias as written within the double quotes that String writes it in,
+// reporting false if it can't be written so without changing its meaning.
+func aliasValue(value string) (string, bool) {
+	switch {
+	case len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'':
+		// single-quoted values are literal, so must hold nothing that double quotes would interpret
+		inner := value[1 : len(value)-1]
+		return inner, !strings.ContainsAny(inner, "'\"$`\\")
+	case len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"':
+		inner := value[1 : len(value)-1]
+		for i := 0; i < len(inner); i++ {
+			switch inner[i] {
+			case '\\':
+				i++
+			case '"':
+				return "", false
+			}
+		}
+		return inner, true
+	}
+	return value, !strings.ContainsAny(value, "'\"$`\\ ")
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
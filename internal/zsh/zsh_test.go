@@ -0,0 +1,73 @@
+package zsh
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		rc   string
+		want Zsh
+	}{
+		{
+			name: "successive PATH exports accumulate",
+			rc: `export PATH="$HOME/bin:$PATH"
+export PATH=/opt/go/bin:$PATH:/usr/games`,
+			want: Zsh{Paths: []string{"/opt/go/bin", "$HOME/bin", "$PATH", "/usr/games"}},
+		},
+		{
+			name: "aliases that can't be double-quoted stay in place",
+			rc: `alias g=git
+alias say='echo "hi"'
+alias ll="ls -la"`,
+			want: Zsh{
+				Aliases: []KV{{Name: "g", Value: "git"}},
+				Suffix: `alias say='echo "hi"'
+alias ll="ls -la"`,
+			},
+		},
+		{
+			name: "lines around unparseable ones keep their position",
+			rc: `export ZSH=~/.oh-my-zsh
+source $ZSH/oh-my-zsh.sh
+HISTSIZE=1000
+setopt SHARE_HISTORY
+export PATH=~/bin:$PATH
+export EDITOR=nvim
+alias g=git
+# local overrides
+source ~/.zshrc.local`,
+			want: Zsh{
+				Prefix: `export ZSH=~/.oh-my-zsh
+source $ZSH/oh-my-zsh.sh`,
+				History:   &History{Size: 1000, ShareHistory: true},
+				Paths:     []string{"~/bin", "$PATH"},
+				Variables: []KV{{Name: "EDITOR", Value: "nvim"}},
+				Aliases:   []KV{{Name: "g", Value: "git"}},
+				Suffix: `# local overrides
+source ~/.zshrc.local`,
+			},
+		},
+		{
+			name: "variables used by a later PATH export stay ahead of it",
+			rc: `export GOPATH=~/go
+export PATH=$GOPATH/bin:$PATH
+alias g=git`,
+			want: Zsh{
+				Prefix:  `export GOPATH=~/go`,
+				Paths:   []string{"$GOPATH/bin", "$PATH"},
+				Aliases: []KV{{Name: "g", Value: "git"}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Parse(tt.rc)
+			if !reflect.DeepEqual(*got, tt.want) {
+				t.Fatalf("got %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
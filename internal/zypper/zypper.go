@@ -0,0 +1,103 @@
+package zypper
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/danielmmetz/settle/internal/pkgmgr"
+	"github.com/danielmmetz/settle/internal/plan"
+)
+
+type Zypper struct {
+	Pkgs []string `json:"pkgs"`
+	// Prune opts in to removing user-installed packages that aren't declared in Pkgs.
+	Prune *pkgmgr.Prune `json:"prune,omitempty"`
+}
+
+func (z *Zypper) UnmarshalJSON(b []byte) error {
+	if pkgs, ok := pkgmgr.BareList[string](b); ok {
+		*z = Zypper{Pkgs: pkgs}
+		return nil
+	}
+	type zypper Zypper
+	var intermediary zypper
+	if err := json.Unmarshal(b, &intermediary); err != nil {
+		return err
+	}
+	*z = Zypper(intermediary)
+	return nil
+}
+
+func (z *Zypper) Ensure(ctx context.Context) error {
+	if z == nil {
+		return nil
+	}
+
+	installed, err := pkgmgr.Zypper{}.Installed(ctx)
+	if err != nil {
+		return err
+	}
+	var missing []string
+	for _, pkg := range z.Pkgs {
+		if _, ok := installed[pkg]; !ok {
+			missing = append(missing, pkg)
+		}
+	}
+	if err := z.install(ctx, missing); err != nil {
+		return err
+	}
+	if z.Prune == nil {
+		return nil
+	}
+	return z.prune(ctx)
+}
+
+func (z *Zypper) install(ctx context.Context, missing []string) error {
+	if len(missing) == 0 {
+		fmt.Printf("all %d zypper packages already present\n", len(z.Pkgs))
+		return nil
+	}
+	if plan.Enabled(ctx) {
+		fmt.Printf("would install %d missing zypper packages: %s\n", len(missing), strings.Join(missing, " "))
+		return nil
+	}
+
+	fmt.Printf("installing %d missing packages with `zypper install`: %s\n", len(missing), strings.Join(missing, " "))
+	if err := (pkgmgr.Zypper{}).Install(ctx, missing); err != nil {
+		return err
+	}
+	fmt.Printf("installed %d zypper packages, %d already present\n", len(missing), len(z.Pkgs)-len(missing))
+	return nil
+}
+
+// prune removes user-installed packages that are neither declared, allowed, nor protected,
+// along with their no longer needed dependencies.
+func (z *Zypper) prune(ctx context.Context) error {
+	userInstalled, err := pkgmgr.Zypper{}.UserInstalled(ctx)
+	if err != nil {
+		return err
+	}
+	undeclared := z.Prune.Undeclared(pkgmgr.Zypper{}, userInstalled, z.Pkgs)
+	if len(undeclared) == 0 {
+		fmt.Println("no undeclared zypper packages to prune")
+		return nil
+	}
+
+	if plan.Enabled(ctx) {
+		fmt.Printf("would prune %d undeclared zypper packages: %s\n", len(undeclared), strings.Join(undeclared, " "))
+		return nil
+	}
+	fmt.Printf("pruning %d undeclared packages with `zypper remove`: %s\n", len(undeclared), strings.Join(undeclared, " "))
+	return pkgmgr.Zypper{}.Remove(ctx, undeclared)
+}
+
+// Current returns the packages installed at the user's request.
+func Current(ctx context.Context) (*Zypper, error) {
+	names, err := pkgmgr.Zypper{}.UserInstalled(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &Zypper{Pkgs: names}, nil
+}
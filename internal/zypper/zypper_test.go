@@ -0,0 +1,39 @@
+package zypper
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/danielmmetz/settle/internal/pkgmgr"
+)
+
+func TestUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+		want Zypper
+	}{
+		{
+			name: "bare list",
+			json: `["vim", "git-core"]`,
+			want: Zypper{Pkgs: []string{"vim", "git-core"}},
+		},
+		{
+			name: "prune",
+			json: `{"pkgs": ["vim"], "prune": {"allow": ["htop"]}}`,
+			want: Zypper{Pkgs: []string{"vim"}, Prune: &pkgmgr.Prune{Allow: []string{"htop"}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got Zypper
+			if err := json.Unmarshal([]byte(tt.json), &got); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
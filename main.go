@@ -33,6 +33,11 @@ func mainE(ctx context.Context) error {
 		ShortHelp:  "Pass -h to see other subcommands. Defaults to `ensure` if no subcommand is provided.",
 		Subcommands: []*ffcli.Command{
 			ensure,
+			cmd.Init(),
+			cmd.Adopt(settingsPath),
+			cmd.Add(settingsPath),
+			cmd.Import(settingsPath),
+			cmd.Remove(settingsPath),
 			cmd.DumpConfig(settingsPath),
 			cmd.Version(version, commit, date),
 		},